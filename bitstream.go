@@ -0,0 +1,118 @@
+/*
+Bit stream writing and reading. Codes are packed MSB first straight into byte slice
+*/
+
+package splurts
+
+import "fmt"
+
+// BitWriter appends codes bit by bit to byte slice. Last byte is padded with 0 bits
+type BitWriter struct {
+	buf   []byte
+	nbits int //Bits written after start
+	start int //Index on buf where this writer started
+}
+
+// NewBitWriter creates writer that appends after existing content of dst. Pass nil for new slice
+func NewBitWriter(dst []byte) *BitWriter {
+	return &BitWriter{buf: dst, start: len(dst)}
+}
+
+// WriteBits writes n lowest bits of v. MSB first
+func (w *BitWriter) WriteBits(v uint64, n int) {
+	if n <= 0 {
+		return
+	}
+	if n < 64 {
+		v &= (uint64(1) << uint(n)) - 1
+	}
+	for 0 < n {
+		used := w.nbits % 8
+		if used == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		free := 8 - used
+		take := free
+		if n < take {
+			take = n
+		}
+		chunk := byte(v>>uint(n-take)) & byte((1<<uint(take))-1)
+		w.buf[len(w.buf)-1] |= chunk << uint(free-take)
+		n -= take
+		w.nbits += take
+	}
+}
+
+// Len number of bits written
+func (w *BitWriter) Len() int {
+	return w.nbits
+}
+
+// Bytes returns dst given at creation with written and padded bytes appended
+func (w *BitWriter) Bytes() []byte {
+	if w.buf == nil {
+		return []byte{}
+	}
+	return w.buf
+}
+
+// Written returns only bytes written by this writer
+func (w *BitWriter) Written() []byte {
+	return w.Bytes()[w.start:]
+}
+
+// String returns written bits as "0101..." string. For debugging and compatibility
+func (w *BitWriter) String() string {
+	result := make([]byte, w.nbits)
+	r := NewBitReader(w.Written())
+	for i := range result {
+		b, _ := r.ReadBits(1)
+		result[i] = '0' + byte(b)
+	}
+	return string(result)
+}
+
+// BitReader reads codes bit by bit from byte slice, MSB first
+type BitReader struct {
+	buf []byte
+	pos int //bit position
+}
+
+// NewBitReader creates reader starting from first bit of buf
+func NewBitReader(buf []byte) *BitReader {
+	return &BitReader{buf: buf}
+}
+
+// Remaining how many bits are left
+func (r *BitReader) Remaining() int {
+	return len(r.buf)*8 - r.pos
+}
+
+// Seek moves read position to bit position from start
+func (r *BitReader) Seek(bitPos int) {
+	r.pos = bitPos
+}
+
+// ReadBits reads n bits as unsigned integer
+func (r *BitReader) ReadBits(n int) (uint64, error) {
+	if 64 < n || n < 0 {
+		return 0, fmt.Errorf("can not read %v bits at once", n)
+	}
+	if r.Remaining() < n {
+		return 0, fmt.Errorf("not enough bits, have %v but %v requested", r.Remaining(), n)
+	}
+	result := uint64(0)
+	for 0 < n {
+		offset := r.pos % 8
+		avail := 8 - offset
+		take := avail
+		if n < take {
+			take = n
+		}
+		chunk := (r.buf[r.pos/8] >> uint(avail-take)) & byte((1<<uint(take))-1)
+		result = result<<uint(take) | uint64(chunk)
+		n -= take
+		r.pos += take
+	}
+	return result, nil
+}
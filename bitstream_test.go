@@ -0,0 +1,275 @@
+package splurts
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBitWriterReader(t *testing.T) {
+	w := NewBitWriter(nil)
+	w.WriteBits(5, 3)
+	w.WriteBits(0, 0)
+	w.WriteBits(0x1FF, 9)
+	w.WriteBits(math.MaxUint64, 64)
+	w.WriteBits(0xFF, 2) //Only lowest bits are used
+	assert.Equal(t, 78, w.Len())
+	assert.Equal(t, 10, len(w.Bytes()))
+	assert.Equal(t, "101111111111"+strings.Repeat("1", 64)+"11", w.String())
+
+	r := NewBitReader(w.Bytes())
+	v, err := r.ReadBits(3)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, uint64(5), v)
+	v, _ = r.ReadBits(9)
+	assert.Equal(t, uint64(0x1FF), v)
+	v, _ = r.ReadBits(64)
+	assert.Equal(t, uint64(math.MaxUint64), v)
+	v, _ = r.ReadBits(2)
+	assert.Equal(t, uint64(3), v)
+	assert.Equal(t, 2, r.Remaining())
+	_, err = r.ReadBits(3)
+	assert.NotEqual(t, nil, err)
+
+	appended := NewBitWriter([]byte{0xAA})
+	appended.WriteBits(1, 1)
+	assert.Equal(t, []byte{0xAA, 0x80}, appended.Bytes())
+	assert.Equal(t, []byte{0x80}, appended.Written())
+}
+
+/*
+Reference implementations from string based bit manipulation. Binary output must stay same
+*/
+func legacyEncodeToBitString(p PiecewiseFloats, values map[string]float64) string {
+	bitString := ""
+	for _, a := range p {
+		if a.Omit {
+			continue
+		}
+		f, haz := values[a.Name]
+		if haz {
+			s, _ := a.BitCode(f)
+			bitString += s
+		} else {
+			bitString += fmt.Sprintf("%b", a.MaxCode())
+		}
+	}
+	return bitString
+}
+
+func legacyBitStringToByteArr(bitString string) []byte {
+	neededPad := 8 - (len(bitString) % 8)
+	if (0 != neededPad) && (8 != neededPad) {
+		bitString += strings.Repeat("0", neededPad)
+	}
+	result := []byte{}
+	for n := 0; n*8 < len(bitString); n++ {
+		v, _ := strconv.ParseInt(bitString[n*8:n*8+8], 2, 64)
+		result = append(result, byte(v))
+	}
+	return result
+}
+
+func legacyEncodeToHexNybble(p PiecewiseFloats, values map[string]float64) string {
+	bitString := legacyEncodeToBitString(p, values)
+	bitString += strings.Repeat("0", 4-(len(bitString)%4))
+	result := ""
+	for n := 0; n*4 < len(bitString); n++ {
+		v, _ := strconv.ParseInt(bitString[n*4:n*4+4], 2, 64)
+		result += fmt.Sprintf("%X", v)
+	}
+	return result
+}
+
+func legacyEncode7bitBytes(p PiecewiseFloats, values map[string]float64) SevenBitArr {
+	s := legacyEncodeToBitString(p, values)
+	pieces := []string{}
+	for len(s) != 0 {
+		n := 7
+		if len(s) < n {
+			n = len(s)
+		}
+		pieces = append(pieces, s[:n])
+		s = s[n:]
+	}
+	if len(pieces) == 0 {
+		return nil
+	}
+	last := len(pieces) - 1
+	pieces[last] += strings.Repeat("0", 7-len(pieces[last]))
+	return legacyBitStringToByteArr("0" + strings.Join(pieces, "0"))
+}
+
+func randomValues(rnd *rand.Rand, p PiecewiseFloats) map[string]float64 {
+	result := make(map[string]float64)
+	for _, a := range p {
+		if a.ConstDefined {
+			result[a.Name] = a.Const
+			continue
+		}
+		if 0 < len(a.Enums) || a.Clamped {
+			result[a.Name] = float64(rnd.Intn(int(a.TotalStepCount())))*a.MinStep() + a.Min
+			continue
+		}
+		switch rnd.Intn(10) {
+		case 0: //missing
+			continue
+		case 1:
+			result[a.Name] = math.NaN()
+		case 2:
+			result[a.Name] = math.Inf(1 - 2*rnd.Intn(2))
+		default:
+			span := a.Max() - a.Min
+			result[a.Name] = a.Min - span*0.1 + rnd.Float64()*span*1.2
+		}
+	}
+	return result
+}
+
+func TestBitStreamCompatibility(t *testing.T) {
+	rnd := rand.New(rand.NewSource(42))
+	for _, example := range []interface{}{AllCases{}, ParticleMeas{}, TimeExampleStruct{}, Simple7{}, SevenBitADC{}} {
+		recipe, errRecipe := GetPiecewisesFromStruct(example)
+		assert.Equal(t, nil, errRecipe)
+		for i := 0; i < 200; i++ {
+			values := randomValues(rnd, recipe)
+
+			assert.Equal(t, legacyEncodeToBitString(recipe, values), recipe.EncodeToBitString(values))
+
+			byt, errEncode := recipe.Encode(values)
+			assert.Equal(t, nil, errEncode)
+			assert.Equal(t, legacyBitStringToByteArr(legacyEncodeToBitString(recipe, values)), byt)
+
+			nybbles, errNybble := recipe.EncodeToHexNybble(values)
+			assert.Equal(t, nil, errNybble)
+			assert.Equal(t, legacyEncodeToHexNybble(recipe, values), nybbles)
+
+			seven, errSeven := recipe.Encode7bitBytes(values)
+			assert.Equal(t, nil, errSeven)
+			assert.Equal(t, legacyEncode7bitBytes(recipe, values), seven)
+
+			decoded, errDecode := recipe.Decode(byt, true)
+			assert.Equal(t, nil, errDecode)
+			decoded7, errDecode7 := recipe.Decode7bitBytes(seven, true)
+			assert.Equal(t, nil, errDecode7)
+			assert.Equal(t, fmt.Sprintf("%v", decoded), fmt.Sprintf("%v", decoded7))
+		}
+	}
+}
+
+func benchmarkRecipe(b *testing.B) (PiecewiseFloats, AllCases) {
+	recipe, errRecipe := GetPiecewisesFromStruct(AllCases{})
+	if errRecipe != nil {
+		b.Fatal(errRecipe)
+	}
+	return recipe, AllCases{Alpha: 2.3, Bravo: 10.1, Charlie: 42, Delta: 123, Echo: true, Foxtrot: 13.5, Golf: 5, Hotel: 26.4,
+		India: 20.4, Juliet: 1.1, Kilo: 25, Lima: 42, Mike: -21.5, November: -90, Oscar: 42.69, Papa: 112.5}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	recipe, d := benchmarkRecipe(b)
+	m, _ := recipe.GetValuesToFloatMap(d)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		recipe.Encode(m)
+	}
+}
+
+func BenchmarkEncodeLegacy(b *testing.B) {
+	recipe, d := benchmarkRecipe(b)
+	m, _ := recipe.GetValuesToFloatMap(d)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		legacyBitStringToByteArr(legacyEncodeToBitString(recipe, m))
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	recipe, d := benchmarkRecipe(b)
+	m, _ := recipe.GetValuesToFloatMap(d)
+	byt, _ := recipe.Encode(m)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		recipe.Decode(byt, true)
+	}
+}
+
+func BenchmarkEncodeHexNybble(b *testing.B) {
+	recipe, d := benchmarkRecipe(b)
+	m, _ := recipe.GetValuesToFloatMap(d)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		recipe.EncodeToHexNybble(m)
+	}
+}
+
+func BenchmarkEncode7bitBytes(b *testing.B) {
+	recipe, d := benchmarkRecipe(b)
+	m, _ := recipe.GetValuesToFloatMap(d)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		recipe.Encode7bitBytes(m)
+	}
+}
+
+func BenchmarkDecode7bitBytes(b *testing.B) {
+	recipe, d := benchmarkRecipe(b)
+	m, _ := recipe.GetValuesToFloatMap(d)
+	byt, _ := recipe.Encode7bitBytes(m)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		recipe.Decode7bitBytes(byt, true)
+	}
+}
+
+func BenchmarkSplurts(b *testing.B) {
+	recipe, d := benchmarkRecipe(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		recipe.Splurts(d)
+	}
+}
+
+func BenchmarkUnSplurts(b *testing.B) {
+	recipe, d := benchmarkRecipe(b)
+	byt, _ := recipe.Splurts(d)
+	out := AllCases{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		recipe.UnSplurts(byt, &out)
+	}
+}
+
+func BenchmarkAppendSplurts(b *testing.B) {
+	recipe, d := benchmarkRecipe(b)
+	buf := make([]byte, 0, recipe.NumberOfBytes())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf, _ = recipe.AppendSplurts(buf[:0], &d)
+	}
+}
+
+func BenchmarkDecodeInto(b *testing.B) {
+	recipe, d := benchmarkRecipe(b)
+	byt, _ := recipe.Splurts(d)
+	values := make([]float64, len(recipe))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		recipe.DecodeInto(byt, values)
+	}
+}
@@ -0,0 +1,335 @@
+/*
+Block floating point. Elements of array or struct field share one exponent code and have own signed mantissas.
+Exponent coding named like Acc.Exp is before element codings. Element value is mantissa*2^exponent,
+exponent is picked so that largest element fits to mantissa. Smaller elements lose precision when block have large values
+*/
+
+package splurts
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+)
+
+const (
+	BLOCKEXPONENT    = "Exp" //Name suffix of exponent coding, like Acc.Exp
+	MAXMANTISSABITS  = 53    //Mantissa must fit to float64
+	MINBLOCKEXPONENT = -1022 //Smallest normal exponent of float64
+	MAXBLOCKEXPONENT = 1023
+)
+
+// BlockCoding is shared by exponent coding and element codings of block floating point field
+type BlockCoding struct {
+	Name         string //Name of block field. Exponent coding is Name.Exp
+	Count        int    //Number of element codings after exponent coding
+	MantissaBits int    //Bits per element, including sign. Most negative code is NaN
+	ExponentBits int    //Highest exponent code is NaN, means that all elements are missing
+	MinExponent  int    //Smallest step of elements is 2^MinExponent
+}
+
+// BlockExponentName name of exponent coding of block field
+func BlockExponentName(name string) string {
+	return name + "." + BLOCKEXPONENT
+}
+
+// MaxExponent largest exponent. Values over maxMantissa*2^MaxExponent saturate
+func (b *BlockCoding) MaxExponent() int {
+	return b.MinExponent + 1<<uint(b.ExponentBits) - 2
+}
+
+func (b *BlockCoding) maxMantissa() float64 {
+	return float64(uint64(1)<<uint(b.MantissaBits-1) - 1)
+}
+
+func (b *BlockCoding) nanCode() uint64 {
+	return uint64(1) << uint(b.MantissaBits-1)
+}
+
+// Exponent picks smallest exponent where largest absolute value fits to mantissa. NaN values are skipped, NaN if all are NaN
+func (b *BlockCoding) Exponent(values []float64) float64 {
+	maxAbs := math.NaN()
+	for _, f := range values {
+		maxAbs = blockMax(maxAbs, f)
+	}
+	return b.exponentOf(maxAbs)
+}
+
+// blockMax accumulates largest absolute value of elements, start from NaN
+func blockMax(maxAbs float64, f float64) float64 {
+	if math.IsNaN(f) {
+		return maxAbs
+	}
+	if math.IsNaN(maxAbs) || maxAbs < math.Abs(f) {
+		return math.Abs(f)
+	}
+	return maxAbs
+}
+
+func (b *BlockCoding) exponentOf(maxAbs float64) float64 {
+	if math.IsNaN(maxAbs) {
+		return math.NaN()
+	}
+	maxExp := b.MaxExponent()
+	if math.IsInf(maxAbs, 0) {
+		return float64(maxExp)
+	}
+	fits := func(e int) bool {
+		return math.Round(math.Ldexp(maxAbs, -e)) <= b.maxMantissa()
+	}
+	e := b.MinExponent
+	if !fits(e) {
+		e = int(math.Ceil(math.Log2(maxAbs / b.maxMantissa())))
+		for b.MinExponent < e && fits(e-1) {
+			e--
+		}
+		for e < maxExp && !fits(e) {
+			e++
+		}
+	}
+	if maxExp < e {
+		e = maxExp
+	}
+	return float64(e)
+}
+
+// Step of elements with exponent
+func (b *BlockCoding) Step(exponent float64) float64 {
+	return math.Ldexp(1, int(exponent))
+}
+
+// QuantizationError of every element on block with exponent. Half step, largest element limits precision of others
+func (b *BlockCoding) QuantizationError(exponent float64) float64 {
+	return b.Step(exponent) / 2
+}
+
+// mantissaCode two's complement mantissa of element. Saturates to largest mantissa
+func (b *BlockCoding) mantissaCode(f float64, exponent float64) uint64 {
+	if math.IsNaN(f) || math.IsNaN(exponent) {
+		return b.nanCode()
+	}
+	m := math.Round(math.Ldexp(f, -int(exponent)))
+	m = math.Max(-b.maxMantissa(), math.Min(b.maxMantissa(), m))
+	return uint64(int64(m)) & (b.nanCode()<<1 - 1)
+}
+
+func (b *BlockCoding) mantissaValue(code uint64, exponent float64) float64 {
+	if math.IsNaN(exponent) || code == b.nanCode() {
+		return math.NaN()
+	}
+	shift := uint(64 - b.MantissaBits)
+	m := int64(code<<shift) >> shift
+	return math.Ldexp(float64(m), int(exponent))
+}
+
+func (b *BlockCoding) isInvalid() error {
+	if b.MantissaBits < 2 || MAXMANTISSABITS < b.MantissaBits {
+		return fmt.Errorf("block %v mantissa must be 2..%v bits, got %v", b.Name, MAXMANTISSABITS, b.MantissaBits)
+	}
+	if b.ExponentBits < 1 || b.MinExponent < MINBLOCKEXPONENT || MAXBLOCKEXPONENT < b.MaxExponent() {
+		return fmt.Errorf("block %v exponents %v..%v are not in range %v..%v", b.Name, b.MinExponent, b.MaxExponent(), MINBLOCKEXPONENT, MAXBLOCKEXPONENT)
+	}
+	if b.Count < 1 {
+		return fmt.Errorf("block %v have no elements", b.Name)
+	}
+	return nil
+}
+
+// isBlockExponent tells is coding exponent of block. Other codings with Block are elements
+func (p *PiecewiseCoding) isBlockExponent() bool {
+	return p.Block != nil && p.Name == BlockExponentName(p.Block.Name)
+}
+
+// isBlockElement tells is coding mantissa of element on block
+func (p *PiecewiseCoding) isBlockElement() bool {
+	return p.Block != nil && !p.isBlockExponent()
+}
+
+func (p *PiecewiseCoding) blockBits() int {
+	if p.isBlockExponent() {
+		return p.Block.ExponentBits
+	}
+	return p.Block.MantissaBits
+}
+
+// scaleBlockToUint exponent is coded from MinExponent, element alone is coded with MinExponent
+func (p *PiecewiseCoding) scaleBlockToUint(f float64) uint64 {
+	if p.isBlockElement() {
+		return p.Block.mantissaCode(f, float64(p.Block.MinExponent))
+	}
+	if math.IsNaN(f) {
+		return p.MaxCode()
+	}
+	e := math.Round(f) - float64(p.Block.MinExponent)
+	return uint64(math.Max(0, math.Min(float64(p.MaxCode()-1), e)))
+}
+
+func (p *PiecewiseCoding) blockToFloat(code uint64) float64 {
+	if p.isBlockElement() {
+		return p.Block.mantissaValue(code, float64(p.Block.MinExponent))
+	}
+	if code == p.MaxCode() {
+		return math.NaN()
+	}
+	return float64(p.Block.MinExponent) + float64(code)
+}
+
+// codeOf converts value to code in order of codings. Exponent coding sets exponent used by following elements
+func (p *PiecewiseCoding) codeOf(f float64, exponent *float64) uint64 {
+	if p.isBlockExponent() {
+		*exponent = p.blockToFloat(p.ScaleToUint(f))
+	}
+	if p.isBlockElement() {
+		return p.Block.mantissaCode(f, *exponent)
+	}
+	return p.ScaleToUint(f)
+}
+
+// valueOf converts code to value in order of codings. Exponent coding sets exponent used by following elements
+func (p *PiecewiseCoding) valueOf(code uint64, exponent *float64) float64 {
+	if p.isBlockElement() {
+		return p.Block.mantissaValue(code, *exponent)
+	}
+	v := p.ScaleToFloat(code)
+	if p.isBlockExponent() {
+		*exponent = v
+	}
+	return v
+}
+
+// missingCode is code of value not present. Element uses NaN mantissa, max code is valid mantissa
+func (p *PiecewiseCoding) missingCode() uint64 {
+	if p.isBlockElement() {
+		return p.Block.nanCode()
+	}
+	return p.MaxCode()
+}
+
+// blockExponent exponent of block at index i from values of elements after it
+func (p PiecewiseFloats) blockExponent(i int, value func(j int) (float64, error)) (float64, error) {
+	maxAbs := math.NaN()
+	for j := i + 1; j < len(p) && j <= i+p[i].Block.Count; j++ {
+		f, err := value(j)
+		if err != nil {
+			return 0, err
+		}
+		maxAbs = blockMax(maxAbs, f)
+	}
+	return p[i].Block.exponentOf(maxAbs), nil
+}
+
+// blocksIsInvalid checks that each exponent coding is followed by its elements
+func (p PiecewiseFloats) blocksIsInvalid() error {
+	var block *PiecewiseCoding
+	remaining := 0
+	for i := range p {
+		a := &p[i]
+		if 0 < remaining {
+			if !a.isBlockElement() || a.Block.Name != block.Block.Name || a.Omit != block.Omit {
+				return fmt.Errorf("block %v have %v elements but %v is not element of it", block.Block.Name, block.Block.Count, a.Name)
+			}
+			remaining--
+			continue
+		}
+		if a.isBlockElement() {
+			return fmt.Errorf("%v is element of block %v but not after exponent coding %v", a.Name, a.Block.Name, BlockExponentName(a.Block.Name))
+		}
+		if a.isBlockExponent() {
+			block = a
+			remaining = a.Block.Count
+		}
+	}
+	if 0 < remaining {
+		return fmt.Errorf("block %v is missing %v elements", block.Block.Name, remaining)
+	}
+	return nil
+}
+
+// blockTag returns value of block directive, empty if field is not block
+func blockTag(tag string) string {
+	for _, tok := range strings.Split(tag, ",") {
+		if strings.HasPrefix(tok, DIRECTIVEBLOCK+"=") {
+			return strings.TrimPrefix(tok, DIRECTIVEBLOCK+"=")
+		}
+	}
+	return ""
+}
+
+// IsBlockField tells is field with tag coded as block floating point. Field must be array of floats or struct with only float fields
+func IsBlockField(t reflect.Type, tag string) bool {
+	if blockTag(tag) == "" {
+		return false
+	}
+	if t.Kind() == reflect.Array {
+		return 0 < t.Len() && isFloatKind(t.Elem().Kind())
+	}
+	if t.Kind() != reflect.Struct || t.NumField() == 0 {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if !isFloatKind(t.Field(i).Type.Kind()) || t.Field(i).Name == BLOCKEXPONENT {
+			return false
+		}
+	}
+	return true
+}
+
+// appendBlockLeaves adds element leaves of block field. Exponent coding is created when first element is met
+func appendBlockLeaves(result *[]structLeaf, t reflect.Type, name string, path []fieldStep, tag string) error {
+	count := t.Len
+	if t.Kind() == reflect.Struct {
+		count = t.NumField
+	}
+	block, errBlock := blockCoding(name, count(), tag)
+	if errBlock != nil {
+		return errBlock
+	}
+	for i := 0; i < block.Count; i++ {
+		leaf := structLeaf{Name: fmt.Sprintf("%s[%v]", name, i), Path: appendStep(path, fieldStep{Index: i, Element: true}), Tag: tag, Block: block}
+		if t.Kind() == reflect.Struct {
+			leaf.Name = name + "." + t.Field(i).Name
+			leaf.Path = appendStep(path, fieldStep{Index: i})
+			leaf.Type = t.Field(i).Type
+		} else {
+			leaf.Type = t.Elem()
+		}
+		*result = append(*result, leaf)
+	}
+	return nil
+}
+
+// blockCoding parses block directives. Step is finest step on small values and max is largest absolute value
+func blockCoding(name string, count int, tag string) (*BlockCoding, error) {
+	dir, dirErr := parseDirectives(tag, "float64")
+	if dirErr != nil {
+		return nil, fmt.Errorf("%v fail %v", name, dirErr.Error())
+	}
+	if dir.Step <= 0 || !dir.MaxDefined || dir.Max <= 0 {
+		return nil, fmt.Errorf("%v block requires positive %v and %v", name, DIRECTIVESTEP, DIRECTIVEMAX)
+	}
+	if dir.MinDefined || 0 < len(dir.Steps) || 0 < dir.Bits || dir.Clamped || dir.Circular || dir.Log || 0 < len(dir.Table) || 0 < len(dir.Specials) || dir.Const != "" || dir.Rounding != ROUNDING_NEAREST || dir.Geo {
+		return nil, fmt.Errorf("%v block is coded by %v, %v and %v only", name, DIRECTIVEBLOCK, DIRECTIVESTEP, DIRECTIVEMAX)
+	}
+	result := BlockCoding{
+		Name:         name,
+		Count:        count,
+		MantissaBits: dir.BlockMantissa,
+		MinExponent:  int(math.Floor(math.Log2(dir.Step))),
+	}
+	maxExp := int(math.Ceil(math.Log2(dir.Max / result.maxMantissa())))
+	if maxExp < result.MinExponent {
+		maxExp = result.MinExponent
+	}
+	result.ExponentBits = bitsForCodes(uint64(maxExp-result.MinExponent) + 2) //Highest code is NaN
+	return &result, result.isInvalid()
+}
+
+// blockLeafCoding creates element coding from block leaf
+func blockLeafCoding(leaf structLeaf) (PiecewiseCoding, error) {
+	dir, dirErr := parseDirectives(leaf.Tag, codingTypename(leaf.Type))
+	if dirErr != nil {
+		return PiecewiseCoding{}, fmt.Errorf("%v fail %v", leaf.Name, dirErr.Error())
+	}
+	return PiecewiseCoding{Omit: dir.Omit, Name: leaf.Name, Block: leaf.Block, Meta: dir.Meta, Deadband: dir.Deadband, DeadbandDefined: dir.DeadbandDefined}, nil
+}
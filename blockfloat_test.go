@@ -0,0 +1,148 @@
+package splurts
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type GyroRate struct {
+	X float32
+	Y float32
+	Z float32
+}
+
+type ImuMeas struct {
+	Acc  [3]float64 `splurts:"block=10,step=0.01,max=160,unit=m/s2"`
+	Rate GyroRate   `splurts:"block=8,step=0.1,max=2000"`
+	Temp float64    `splurts:"min=-40,max=85,step=0.5"`
+}
+
+type BadBlockScalar struct {
+	Acc float64 `splurts:"block=10,step=0.01,max=160"`
+}
+
+type BadBlockRange struct {
+	Acc [3]float64 `splurts:"block=10,step=0.01"`
+}
+
+func TestBlockFloat(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(ImuMeas{})
+	assert.Equal(t, nil, errRecipe)
+	assert.Equal(t, []string{"Acc.Exp", "Acc[0]", "Acc[1]", "Acc[2]", "Rate.Exp", "Rate.X", "Rate.Y", "Rate.Z", "Temp"}, recipe.Names())
+	assert.Equal(t, nil, recipe.IsInvalid())
+	assert.Equal(t, "m/s2", recipe[1].Meta.Unit)
+	assert.Equal(t, "", recipe[0].Meta.Unit)
+
+	acc := recipe[1].Block
+	assert.Equal(t, -7, acc.MinExponent)
+	assert.Equal(t, -1, acc.MaxExponent())
+	assert.Equal(t, 3, recipe[0].NumberOfBits())
+	assert.Equal(t, 10, recipe[1].NumberOfBits())
+	assert.Equal(t, 4, recipe[4].NumberOfBits())
+	assert.Equal(t, 8, recipe[5].NumberOfBits())
+	assert.Equal(t, 3+30+4+24+8, recipe.NumberOfBits())
+
+	d := ImuMeas{Acc: [3]float64{9.81, -0.5, 0.02}, Rate: GyroRate{X: 1500, Y: -3, Z: 0.2}, Temp: 21.5}
+	byt, errSplurt := recipe.Splurts(d)
+	assert.Equal(t, nil, errSplurt)
+	back := ImuMeas{}
+	assert.Equal(t, nil, recipe.UnSplurts(byt, &back))
+	assert.Equal(t, 9.8125, back.Acc[0], "largest element picks exponent -5")
+	assert.Equal(t, -0.5, back.Acc[1])
+	assert.Equal(t, 0.03125, back.Acc[2])
+	assert.Equal(t, float32(1504), back.Rate.X)
+	assert.Equal(t, float32(0), back.Rate.Y, "small values are lost when block have large value")
+	assert.Equal(t, 21.5, back.Temp)
+	for i := range d.Acc {
+		assert.InDelta(t, d.Acc[i], back.Acc[i], acc.QuantizationError(-5))
+	}
+	assert.InDelta(t, d.Rate.Y, back.Rate.Y, recipe[6].Block.QuantizationError(4))
+	assert.Equal(t, float64(-5), acc.Exponent(d.Acc[:]))
+
+	m, errDecode := recipe.Decode(byt, true)
+	assert.Equal(t, nil, errDecode)
+	assert.Equal(t, float64(-5), m["Acc.Exp"])
+	assert.Equal(t, float64(4), m["Rate.Exp"])
+	again, errEncode := recipe.Encode(m)
+	assert.Equal(t, nil, errEncode)
+	assert.Equal(t, byt, again)
+
+	values := make([]float64, len(recipe))
+	assert.Equal(t, nil, recipe.DecodeInto(byt, values))
+	appended, errAppend := recipe.AppendEncode(nil, values)
+	assert.Equal(t, nil, errAppend)
+	assert.Equal(t, byt, appended)
+
+	codec, errCodec := NewStructCodec(ImuMeas{})
+	assert.Equal(t, nil, errCodec)
+	codecByt, errCodecSplurt := codec.Splurts(&d)
+	assert.Equal(t, nil, errCodecSplurt)
+	assert.Equal(t, byt, codecByt)
+	codecBack := ImuMeas{}
+	assert.Equal(t, nil, codec.UnSplurts(byt, &codecBack))
+	assert.Equal(t, back, codecBack)
+	v, errValue := codec.DecodeValue(byt, "Acc[1]")
+	assert.Equal(t, nil, errValue)
+	assert.Equal(t, -0.5, v)
+}
+
+func TestBlockFloatMissingAndSaturation(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(ImuMeas{})
+	assert.Equal(t, nil, errRecipe)
+
+	nan := float32(math.NaN())
+	d := ImuMeas{Acc: [3]float64{1000, math.NaN(), -2}, Rate: GyroRate{X: nan, Y: nan, Z: nan}}
+	byt, errSplurt := recipe.Splurts(d)
+	assert.Equal(t, nil, errSplurt)
+	back := ImuMeas{}
+	assert.Equal(t, nil, recipe.UnSplurts(byt, &back))
+	assert.Equal(t, 255.5, back.Acc[0], "saturates to largest mantissa on largest exponent")
+	assert.True(t, math.IsNaN(back.Acc[1]))
+	assert.Equal(t, -2.0, back.Acc[2])
+	assert.True(t, math.IsNaN(float64(back.Rate.X)))
+
+	m, errDecode := recipe.Decode(byt, true)
+	assert.Equal(t, nil, errDecode)
+	assert.True(t, math.IsNaN(m["Rate.Exp"]), "all elements missing")
+}
+
+type VectorMeas struct {
+	V [3]float64 `splurts:"block=10,step=0.001,max=100"`
+}
+
+func TestBlockFloatExport(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(VectorMeas{})
+	assert.Equal(t, nil, errRecipe)
+	assert.Equal(t, 0, recipe[0].Decimals(), "exponent is integer")
+	assert.Equal(t, 4, recipe[1].Decimals(), "finest step is 2^-10")
+	assert.Equal(t, []string{"V[0]", "V[1]", "V[2]"}, recipe.ExportNames(), "exponent is not value")
+
+	byt, errSplurt := recipe.Splurts(VectorMeas{V: [3]float64{0.123, -0.5, 0.01}})
+	assert.Equal(t, nil, errSplurt)
+	back := VectorMeas{}
+	assert.Equal(t, nil, recipe.UnSplurts(byt, &back))
+	strs, errStrings := recipe.ToStrings(back, false)
+	assert.Equal(t, nil, errStrings)
+	assert.Equal(t, "0.1230", strs["V[0]"])
+	assert.Equal(t, "-0.5000", strs["V[1]"])
+	assert.Equal(t, "0.0098", strs["V[2]"])
+	assert.Equal(t, "-9", strs["V.Exp"])
+	csv, errCsv := recipe.ToCsv([]VectorMeas{back}, ";", nil, false)
+	assert.Equal(t, nil, errCsv)
+	assert.Equal(t, "0.1230;-0.5000;0.0098\n", csv)
+}
+
+func TestBlockFloatInvalid(t *testing.T) {
+	_, errScalar := GetPiecewisesFromStruct(BadBlockScalar{})
+	assert.NotEqual(t, nil, errScalar)
+	_, errRange := GetPiecewisesFromStruct(BadBlockRange{})
+	assert.NotEqual(t, nil, errRange)
+
+	recipe, _ := GetPiecewisesFromStruct(ImuMeas{})
+	noExponent := recipe[1:]
+	assert.NotEqual(t, nil, noExponent.IsInvalid(), "elements without exponent")
+	missing := append(recipe[:2:2], recipe[8])
+	assert.NotEqual(t, nil, missing.IsInvalid(), "missing elements")
+}
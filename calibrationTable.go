@@ -0,0 +1,149 @@
+/*
+Calibration table coding. Code to value breakpoints with linear interpolation between, like thermistor tables.
+Table codes are codes on wire. When table is not clamped, -inf is just above last table code and special codes, +inf and NaN are on top like on other codings
+*/
+
+package splurts
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// CalibrationPoint is one breakpoint of calibration table
+type CalibrationPoint struct {
+	Code  uint64
+	Value float64
+}
+
+// parseCalibrationTable parses table in format "code value|code value|..." like steps directive
+func parseCalibrationTable(s string) ([]CalibrationPoint, error) {
+	result := []CalibrationPoint{}
+	for n, sPoint := range strings.Split(s, "|") {
+		codeValue := strings.Split(sPoint, " ")
+		if len(codeValue) != 2 {
+			return nil, fmt.Errorf("only code value pairs NOT %#v", sPoint)
+		}
+		code, errCode := strconv.ParseUint(codeValue[0], 0, 64)
+		value, errValue := strconv.ParseFloat(codeValue[1], 64)
+		if errCode != nil || errValue != nil {
+			return nil, fmt.Errorf("error on table point %v", n)
+		}
+		result = append(result, CalibrationPoint{Code: code, Value: value})
+	}
+	return result, nil
+}
+
+// tableIsInvalid codes must increase and values must be monotonic, increasing or decreasing
+func (p *PiecewiseCoding) tableIsInvalid() error {
+	if len(p.Table) < 2 {
+		return fmt.Errorf("calibration table of %v requires at least two points", p.Name)
+	}
+	increasing := p.Table[0].Value < p.Table[1].Value
+	for i := 1; i < len(p.Table); i++ {
+		a, b := p.Table[i-1], p.Table[i]
+		if b.Code <= a.Code {
+			return fmt.Errorf("calibration table of %v codes must increase, index %v", p.Name, i)
+		}
+		if a.Value == b.Value || (a.Value < b.Value) != increasing || math.IsNaN(b.Value) {
+			return fmt.Errorf("calibration table of %v values must be monotonic, index %v", p.Name, i)
+		}
+	}
+	return nil
+}
+
+// tableRange returns lowest and highest value with codes of those
+func (p *PiecewiseCoding) tableRange() (CalibrationPoint, CalibrationPoint) {
+	first, last := p.Table[0], p.Table[len(p.Table)-1]
+	if first.Value < last.Value {
+		return first, last
+	}
+	return last, first
+}
+
+// tableToFloat interpolates value of table code. Codes outside table are clamped to end points
+func (p *PiecewiseCoding) tableToFloat(code uint64) float64 {
+	if code <= p.Table[0].Code {
+		return p.Table[0].Value
+	}
+	for i := 1; i < len(p.Table); i++ {
+		a, b := p.Table[i-1], p.Table[i]
+		if code <= b.Code {
+			return a.Value + float64(code-a.Code)*(b.Value-a.Value)/float64(b.Code-a.Code)
+		}
+	}
+	return p.Table[len(p.Table)-1].Value
+}
+
+// tableToCode finds nearest table code of value. Value must be inside table range
+func (p *PiecewiseCoding) tableToCode(f float64) uint64 {
+	for i := 1; i < len(p.Table); i++ {
+		a, b := p.Table[i-1], p.Table[i]
+		if math.Min(a.Value, b.Value) <= f && f <= math.Max(a.Value, b.Value) {
+			return a.Code + p.roundSteps((f-a.Value)/(b.Value-a.Value)*float64(b.Code-a.Code), b.Code-a.Code, b.Value < a.Value)
+		}
+	}
+	return p.Table[len(p.Table)-1].Code
+}
+
+// tableSlope absolute value change per code on segment i
+func (p *PiecewiseCoding) tableSlope(i int) float64 {
+	a, b := p.Table[i-1], p.Table[i]
+	return math.Abs((b.Value - a.Value) / float64(b.Code-a.Code))
+}
+
+func (p *PiecewiseCoding) tableMinStep() float64 {
+	result := p.tableSlope(1)
+	for i := 2; i < len(p.Table); i++ {
+		result = math.Min(result, p.tableSlope(i))
+	}
+	return result
+}
+
+func (p *PiecewiseCoding) tableLocalStep(f float64) float64 {
+	for i := 1; i < len(p.Table); i++ {
+		a, b := p.Table[i-1], p.Table[i]
+		if math.Min(a.Value, b.Value) <= f && f <= math.Max(a.Value, b.Value) {
+			return p.tableSlope(i)
+		}
+	}
+	lowest, _ := p.tableRange()
+	if f <= lowest.Value {
+		if lowest == p.Table[0] {
+			return p.tableSlope(1)
+		}
+		return p.tableSlope(len(p.Table) - 1)
+	}
+	if lowest == p.Table[0] {
+		return p.tableSlope(len(p.Table) - 1)
+	}
+	return p.tableSlope(1)
+}
+
+// negInfCode is code of -inf when coding is not clamped. Zero except on calibration table
+func (p *PiecewiseCoding) negInfCode() uint64 {
+	if 0 < len(p.Table) {
+		return p.Table[len(p.Table)-1].Code + 1
+	}
+	return 0
+}
+
+// scaleTableToUint is ScaleToUint for calibration table. Values outside table are -inf and +inf or clamped to end points
+func (p *PiecewiseCoding) scaleTableToUint(f float64) uint64 {
+	lowest, highest := p.tableRange()
+	switch {
+	case f < lowest.Value:
+		if p.Clamped {
+			return lowest.Code
+		}
+		return p.negInfCode()
+	case highest.Value < f:
+		if p.Clamped {
+			return highest.Code
+		}
+		return p.MaxCode() - 1
+	}
+	return p.tableToCode(f)
+}
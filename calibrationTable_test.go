@@ -0,0 +1,83 @@
+package splurts
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalibrationTable(t *testing.T) {
+	dut := PiecewiseCoding{ //NTC, temperature goes down when code goes up
+		Name:  "ntc",
+		Table: []CalibrationPoint{{Code: 100, Value: 125}, {Code: 1000, Value: 60}, {Code: 2000, Value: 25}, {Code: 4000, Value: -40}},
+	}
+	assert.Equal(t, nil, dut.IsInvalid())
+	assert.Equal(t, uint64(4001), dut.TotalStepCount())
+	assert.Equal(t, 12, dut.NumberOfBits())
+	assert.Equal(t, float64(125), dut.Max())
+
+	assert.Equal(t, uint64(2000), dut.ScaleToUint(25), "table code is code on wire")
+	assert.Equal(t, uint64(1500), dut.ScaleToUint(42.5))
+	assert.Equal(t, float64(42.5), dut.ScaleToFloat(1500))
+	assert.Equal(t, float64(125), dut.ScaleToFloat(1))
+	assert.Equal(t, uint64(4001), dut.ScaleToUint(-50), "-inf is above last table code")
+	assert.Equal(t, dut.MaxCode()-1, dut.ScaleToUint(130))
+	for _, f := range []float64{124.9, 61, 30, 0, -39.9} {
+		assert.InDelta(t, f, dut.ScaleToFloat(dut.ScaleToUint(f)), dut.LocalStep(f)/2+1e-9, "value %v", f)
+	}
+	assert.True(t, math.IsInf(dut.ScaleToFloat(dut.ScaleToUint(-50)), -1))
+	assert.True(t, math.IsInf(dut.ScaleToFloat(dut.ScaleToUint(130)), 1))
+	assert.True(t, math.IsNaN(dut.ScaleToFloat(dut.ScaleToUint(math.NaN()))))
+
+	assert.InDelta(t, 0.0325, dut.MinStep(), 1e-12)
+	assert.Equal(t, 2, dut.Decimals())
+	s, _ := dut.ToStringValue(dut.ScaleToFloat(dut.ScaleToUint(100)))
+	assert.Equal(t, "100.01", s)
+
+	dut.Clamped = true
+	assert.Equal(t, uint64(100), dut.ScaleToUint(200))
+	assert.Equal(t, uint64(4000), dut.ScaleToUint(-200))
+	assert.Equal(t, float64(125), dut.ScaleToFloat(0))
+
+	adc := PiecewiseCoding{Name: "adc", Table: []CalibrationPoint{{Code: 0, Value: 0}, {Code: 4095, Value: 3.3}}}
+	assert.Equal(t, 13, adc.NumberOfBits(), "-inf, +inf and NaN do not fit on 12 bits with full table")
+	assert.Equal(t, uint64(4095), adc.ScaleToUint(3.3))
+	adc.Clamped = true
+	assert.Equal(t, 12, adc.NumberOfBits())
+	assert.Equal(t, uint64(4095), adc.ScaleToUint(3.3))
+
+	dut.Table[2].Value = 70
+	assert.NotEqual(t, nil, dut.IsInvalid(), "not monotonic")
+	dut.Table = dut.Table[:1]
+	assert.NotEqual(t, nil, dut.IsInvalid(), "too short")
+}
+
+type ThermistorMeas struct {
+	Temperature float64 `splurts:"table=100 125|1000 60|2000 25|4000 -40"`
+	Fixed       float64 `splurts:"table=0 0|10 1|20 10,clamped"`
+}
+
+func TestCalibrationTableDirective(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(ThermistorMeas{})
+	assert.Equal(t, nil, errRecipe)
+	assert.Equal(t, float64(-40), recipe[0].Min)
+	assert.Equal(t, 12+5, recipe.NumberOfBits())
+
+	d := ThermistorMeas{Temperature: 21.3, Fixed: 5.5}
+	byt, errSplurt := recipe.Splurts(d)
+	assert.Equal(t, nil, errSplurt)
+	back := ThermistorMeas{}
+	assert.Equal(t, nil, recipe.UnSplurts(byt, &back))
+	assert.InDelta(t, d.Temperature, back.Temperature, 0.02)
+	assert.Equal(t, d.Fixed, back.Fixed)
+
+	pw := recipe.Clone()
+	pw[0].Table[0].Value = 0
+	assert.Equal(t, float64(125), recipe[0].Table[0].Value, "clone must copy table")
+
+	for _, tag := range []string{"table=100 125", "table=100 125|50 20", "table=100|200", "table=1 1|2 x"} {
+		_, errCoding := createPiecewiseCodingFromStruct("A", "float64", tag)
+		assert.NotEqual(t, nil, errCoding, tag)
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Circular quantities like wind direction, heading and phase wrap around from max to min.
+Value is quantized modulo range, max is same code as min. There are no NaN or ±inf codes, circular coding is always clamped
+*/
+
+package splurts
+
+import (
+	"fmt"
+	"math"
+)
+
+// Period length of circular range
+func (p *PiecewiseCoding) Period() float64 {
+	return p.Max() - p.Min
+}
+
+// wrapCircular brings value to range [min,max)
+func (p *PiecewiseCoding) wrapCircular(f float64) float64 {
+	period := p.Period()
+	x := math.Mod(f-p.Min, period)
+	if x < 0 {
+		x += period
+	}
+	return p.Min + x
+}
+
+// scaleCircularToUint value rounded up to max wraps to code 0
+func (p *PiecewiseCoding) scaleCircularToUint(f float64) uint64 {
+	if math.IsInf(f, 0) {
+		return p.MaxCode()
+	}
+	f = p.wrapCircular(f)
+	total := p.Min
+	stepcounter := uint64(0)
+	for _, step := range p.Steps {
+		a := total
+		total += float64(step.Count) * step.Size
+		if f <= total {
+			result := stepcounter + p.roundSteps((f-a)/step.Size, step.Count, false)
+			return result % p.TotalStepCount()
+		}
+		stepcounter += step.Count
+	}
+	return 0 //Rounding error at max, same as min
+}
+
+// circularToFloat codes above step count are wrapped like values
+func (p *PiecewiseCoding) circularToFloat(v uint64) float64 {
+	v %= p.TotalStepCount()
+	binvalue := uint64(0)
+	total := p.Min
+	for _, step := range p.Steps {
+		a := binvalue
+		binvalue += step.Count
+		if v < binvalue {
+			return total + float64(v-a)*step.Size
+		}
+		total += float64(step.Count) * step.Size
+	}
+	return total
+}
+
+// circularValueIsInvalid rejects NaN and ±inf on circular coding, they do not have codes
+func (p *PiecewiseCoding) circularValueIsInvalid(f float64) error {
+	if p.Circular && !p.ConstDefined && (math.IsNaN(f) || math.IsInf(f, 0)) {
+		return fmt.Errorf("circular %v does not have code for %v", p.Name, f)
+	}
+	return nil
+}
+
+// circularValuesIsInvalid checks values indexed same way as PiecewiseFloats
+func (p PiecewiseFloats) circularValuesIsInvalid(values []float64) error {
+	for i := range p {
+		if p[i].Omit {
+			continue
+		}
+		errValue := p[i].circularValueIsInvalid(values[i])
+		if errValue != nil {
+			return errValue
+		}
+	}
+	return nil
+}
+
+// circularMapIsInvalid checks map of values, missing value is NaN
+func (p PiecewiseFloats) circularMapIsInvalid(values map[string]float64) error {
+	for i := range p {
+		if !p[i].Circular || p[i].Omit {
+			continue
+		}
+		f, haz := values[p[i].Name]
+		if !haz {
+			f = math.NaN()
+		}
+		errValue := p[i].circularValueIsInvalid(f)
+		if errValue != nil {
+			return errValue
+		}
+	}
+	return nil
+}
+
+func (p *PiecewiseCoding) circularIsInvalid() error {
+	if !p.Clamped {
+		return fmt.Errorf("internal error circular %v must be clamped, it does not have NaN or ±inf codes", p.Name)
+	}
+	if p.Log || 0 < len(p.Table) || 0 < len(p.Specials) || p.codeValued() {
+		return fmt.Errorf("%v circular coding must be linear steps without log, table, special codes, enums, flags or text", p.Name)
+	}
+	if p.TotalStepCount() == 0 {
+		return fmt.Errorf("no steps defined at %v", p.Name)
+	}
+	return nil
+}
+
+// circularCoding divides range from min to max evenly, so max wraps exactly to min
+func circularCoding(result PiecewiseCoding, dir DirectiveSettings, typename string) (PiecewiseCoding, error) {
+	switch typename {
+	case "string", typenameFlags, typenameTime:
+		return result, fmt.Errorf("%v circular coding requires number field, not %v", result.Name, typename)
+	}
+	if 0 < len(result.Steps) { //Explicit steps define period
+		return result, result.circularIsInvalid()
+	}
+	if !dir.MaxDefined || dir.Max <= dir.Min {
+		return result, fmt.Errorf("%v circular coding requires max > min", result.Name)
+	}
+	span := dir.Max - dir.Min
+	count := uint64(math.Ceil(span/dir.Step - roundingTolerance))
+	if 0 < dir.Bits {
+		count = uint64(1) << uint(dir.Bits)
+	}
+	result.Steps = []PiecewiseCodingStep{{Size: span / float64(count), Count: count}}
+	return result, result.circularIsInvalid()
+}
@@ -0,0 +1,65 @@
+package splurts
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type WindMeas struct {
+	Direction float64 `splurts:"circular,min=0,max=360,step=0.5"`
+	Phase     float64 `splurts:"circular,min=-180,max=180,bits=8"`
+	Heading   int     `splurts:"circular,min=0,max=360,step=7"` //Step is adjusted so 360 divides evenly
+}
+
+func TestCircular(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(WindMeas{})
+	assert.Equal(t, nil, errRecipe)
+	assert.Equal(t, true, recipe[0].Clamped)
+	assert.Equal(t, uint64(720), recipe[0].TotalStepCount())
+	assert.Equal(t, 10, recipe[0].NumberOfBits(), "no NaN or inf codes")
+	assert.Equal(t, 8, recipe[1].NumberOfBits())
+	assert.Equal(t, 360.0, recipe[2].Period())
+	assert.Equal(t, uint64(52), recipe[2].TotalStepCount())
+
+	dir := recipe[0]
+	assert.Equal(t, uint64(0), dir.ScaleToUint(359.9), "rounds up to max, same as min")
+	assert.Equal(t, uint64(1), dir.ScaleToUint(360.4))
+	assert.Equal(t, uint64(719), dir.ScaleToUint(-0.5))
+	assert.Equal(t, uint64(2), dir.ScaleToUint(721))
+	assert.Equal(t, 359.5, dir.ScaleToFloat(719))
+	assert.Equal(t, 0.5, dir.ScaleToFloat(721), "unused codes wrap")
+
+	d := WindMeas{Direction: 359.8, Phase: 190, Heading: -14}
+	byt, errSplurt := recipe.Splurts(d)
+	assert.Equal(t, nil, errSplurt)
+	back := WindMeas{}
+	assert.Equal(t, nil, recipe.UnSplurts(byt, &back))
+	assert.Equal(t, 0.0, back.Direction)
+	assert.InDelta(t, -170, back.Phase, recipe[1].QuantizationError())
+	assert.InDelta(t, 346, back.Heading, 1)
+
+	assert.Equal(t, 0.25, dir.QuantizationError())
+	assert.False(t, math.IsNaN(dir.ScaleToFloat(dir.ScaleToUint(math.NaN()))), "NaN is not coded")
+
+	codec, errCodec := NewStructCodec(WindMeas{})
+	assert.Equal(t, nil, errCodec)
+	for _, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		_, errSplurt = recipe.Splurts(WindMeas{Direction: f})
+		assert.NotEqual(t, nil, errSplurt, "%v", f)
+		_, errSplurt = codec.Splurts(WindMeas{Direction: f})
+		assert.NotEqual(t, nil, errSplurt, "%v", f)
+		_, errEncode := recipe.AppendEncode(nil, []float64{f, 0, 0})
+		assert.NotEqual(t, nil, errEncode, "%v", f)
+	}
+	_, errEncode := recipe.Encode(map[string]float64{"Direction": 1, "Phase": 2})
+	assert.NotEqual(t, nil, errEncode, "missing heading")
+
+	for _, tag := range []string{"circular,min=0", "circular,min=10,max=0,step=1", "circular,log,min=1,max=360,relstep=1%", "circular,min=0,max=360,infpos=1", "circular,min=0,max=360,special=X"} {
+		_, errCoding := createPiecewiseCodingFromStruct("A", "float64", tag)
+		assert.NotEqual(t, nil, errCoding, tag)
+	}
+	_, errCoding := createPiecewiseCodingFromStruct("A", "string", "circular,min=0,max=360")
+	assert.NotEqual(t, nil, errCoding)
+}
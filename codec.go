@@ -0,0 +1,615 @@
+/*
+Compiled coding plans. Reflection on struct type is done only once and cached
+*/
+
+package splurts
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// fieldGetter reads struct field as float, before infpos, infneg and const overrides
+type fieldGetter func(f reflect.Value, pw *PiecewiseCoding) (float64, error)
+
+// fieldSetter sets decoded float to struct field
+type fieldSetter func(f reflect.Value, pw *PiecewiseCoding, v float64) error
+
+type planField struct {
+	Name string
+	Path []fieldStep //Path from struct to value, nested structs and arrays are flattened
+	get  fieldGetter
+	set  fieldSetter
+}
+
+// structPlan is reflection result of one struct type. Shared by PiecewiseFloats methods and StructCodec
+type structPlan struct {
+	fields []planField
+	byName map[string]int //name to index on fields
+}
+
+var structPlans sync.Map //reflect.Type -> *structPlan
+
+func getStructPlan(t reflect.Type) (*structPlan, error) {
+	cached, haz := structPlans.Load(t)
+	if haz {
+		return cached.(*structPlan), nil
+	}
+	leaves, errFlatten := flattenStruct(t)
+	if errFlatten != nil {
+		return nil, errFlatten
+	}
+	plan := &structPlan{
+		fields: make([]planField, len(leaves)),
+		byName: make(map[string]int),
+	}
+	for i, leaf := range leaves {
+		get, set := accessorsByType(leaf.Type)
+		if leaf.Coding != nil {
+			get, set = marshalerAccessors(leaf.Sub)
+		}
+		plan.fields[i] = planField{Name: leaf.Name, Path: leaf.Path, get: get, set: set}
+		plan.byName[leaf.Name] = i
+	}
+	actual, _ := structPlans.LoadOrStore(t, plan)
+	return actual.(*structPlan), nil
+}
+
+// value returns field from struct value
+func (pf *planField) value(elem reflect.Value) reflect.Value {
+	result := elem
+	for _, step := range pf.Path {
+		if step.Element {
+			result = result.Index(step.Index)
+		} else {
+			result = result.Field(step.Index)
+		}
+	}
+	return result
+}
+
+func (plan *structPlan) field(name string) *planField {
+	i, haz := plan.byName[name]
+	if !haz {
+		return nil
+	}
+	return &plan.fields[i]
+}
+
+// encodeValues calls fn with value of each non omitted coding. Codings not present on struct are called with haz=false
+func (plan *structPlan) encodeValues(p PiecewiseFloats, elem reflect.Value, fn func(pw *PiecewiseCoding, f float64, haz bool)) error {
+	matched := 0
+	for i := range p {
+		pw := &p[i]
+		pf := plan.field(pw.Name)
+		if pf != nil {
+			matched++
+		}
+		if pw.Omit && !(pw.Epoch && pf != nil) { //Omitted epoch is still needed for relative values and exports
+			continue
+		}
+		if pw.isBlockExponent() { //Not a struct field, picked by values of elements
+			f, errExp := p.blockExponent(i, func(j int) (float64, error) {
+				element := plan.field(p[j].Name)
+				if element == nil {
+					return math.NaN(), nil
+				}
+				return p[j].getFieldValue(element, nil, elem)
+			})
+			if errExp != nil {
+				return errExp
+			}
+			fn(pw, f, true)
+			continue
+		}
+		if pf == nil {
+			fn(pw, 0, false)
+			continue
+		}
+		base, errBase := plan.epochField(pw)
+		if errBase != nil {
+			return errBase
+		}
+		f, errGet := pw.getFieldValue(pf, base, elem)
+		if errGet != nil {
+			return errGet
+		}
+		fn(pw, f, true)
+	}
+	if matched < len(plan.fields) { //Every field on struct must have coding
+		for _, pf := range plan.fields {
+			_, errFound := p.getCoding(pf.Name)
+			if errFound != nil {
+				return errFound
+			}
+		}
+	}
+	return nil
+}
+
+// epochField returns field that relative time is coded from, nil if coding is not relative
+func (plan *structPlan) epochField(pw *PiecewiseCoding) (*planField, error) {
+	if pw.RelativeTo == "" {
+		return nil, nil
+	}
+	base := plan.field(pw.RelativeTo)
+	if base == nil {
+		return nil, fmt.Errorf("epoch %v of relative field %v not found", pw.RelativeTo, pw.Name)
+	}
+	return base, nil
+}
+
+// getFieldValue reads value and applies overrides. Relative time is converted to offset from base
+func (pw *PiecewiseCoding) getFieldValue(pf *planField, base *planField, elem reflect.Value) (float64, error) {
+	result, err := pf.get(pf.value(elem), pw)
+	if err != nil {
+		return 0, err
+	}
+	if base != nil {
+		epoch, errEpoch := base.get(base.value(elem), pw)
+		if errEpoch != nil {
+			return 0, errEpoch
+		}
+		result -= epoch
+	}
+	if pw.InfPosDefined && math.IsInf(result, 1) {
+		result = pw.InfPos
+	}
+	if pw.InfNegDefined && math.IsInf(result, -1) {
+		result = pw.InfNeg
+	}
+	if pw.ConstDefined {
+		result = pw.Const
+	}
+	if 0 < len(pw.Enums) { //Integer enums are checked here, unknown values are coded as EnumUnknown
+		if result < 0 {
+			return 0, fmt.Errorf("%v enum code is negative %v", pw.Name, result)
+		}
+		code, errEnum := pw.decodeEnum(uint64(result))
+		if errEnum != nil {
+			return 0, errEnum
+		}
+		result = float64(code)
+	}
+	if 0 < len(pw.Flags) && (result < 0 || uint64(result)>>uint(len(pw.Flags)) != 0) {
+		return 0, fmt.Errorf("%v mask %v have bits outside of %v flags", pw.Name, result, len(pw.Flags))
+	}
+	return result, nil
+}
+
+// setFieldValue sets decoded value. Relative time is converted back to absolute by using already set base
+func (pw *PiecewiseCoding) setFieldValue(pf *planField, base *planField, elem reflect.Value, v float64) error {
+	if base != nil {
+		epoch, errEpoch := base.get(base.value(elem), pw)
+		if errEpoch != nil {
+			return errEpoch
+		}
+		v += epoch
+	}
+	return pf.set(pf.value(elem), pw, v)
+}
+
+// accessorsByType picks accessors for field type. Pointer fields are optional values, nil is NaN
+func accessorsByType(t reflect.Type) (fieldGetter, fieldSetter) {
+	if t.Kind() == reflect.Pointer {
+		get, set := accessorsByTypename(codingTypename(t.Elem()))
+		return optionalAccessors(t.Elem(), get, set)
+	}
+	return accessorsByTypename(codingTypename(t))
+}
+
+func accessorsByTypename(typename string) (fieldGetter, fieldSetter) {
+	switch typename {
+	case "float64", "float32":
+		return getFloatField, setFloatField
+	case "int", "int8", "int16", "int32", "int64":
+		return getIntField, setIntField
+	case "uint", "uint8", "uint16", "uint32", "uint64":
+		return getUintField, setUintField
+	case "bool":
+		return getBoolField, setBoolField
+	case "string":
+		return getEnumField, setEnumField
+	case typenameFlags:
+		return getFlagsField, setFlagsField
+	case typenameTime:
+		return getTimeField, setTimeField
+	case typenameDuration:
+		return getDurationField, setDurationField
+	}
+	return getUnknownField, setUnknownField
+}
+
+func getFloatField(f reflect.Value, pw *PiecewiseCoding) (float64, error) {
+	return f.Float(), nil
+}
+
+func setFloatField(f reflect.Value, pw *PiecewiseCoding, v float64) error {
+	f.SetFloat(v)
+	return nil
+}
+
+func getIntField(f reflect.Value, pw *PiecewiseCoding) (float64, error) {
+	return float64(f.Int()), nil
+}
+
+func setIntField(f reflect.Value, pw *PiecewiseCoding, v float64) error {
+	f.SetInt(int64(v))
+	return nil
+}
+
+func getUintField(f reflect.Value, pw *PiecewiseCoding) (float64, error) {
+	return float64(f.Uint()), nil
+}
+
+func setUintField(f reflect.Value, pw *PiecewiseCoding, v float64) error {
+	f.SetUint(uint64(v))
+	return nil
+}
+
+func getBoolField(f reflect.Value, pw *PiecewiseCoding) (float64, error) {
+	if f.Bool() {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func setBoolField(f reflect.Value, pw *PiecewiseCoding, v float64) error {
+	f.SetBool(0 < v)
+	return nil
+}
+
+func getEnumField(f reflect.Value, pw *PiecewiseCoding) (float64, error) {
+	if 0 < pw.TextLength {
+		code, errText := pw.TextCode(f.String())
+		return float64(code), errText
+	}
+	code, errCode := pw.EnumCode(f.String())
+	return float64(code), errCode
+}
+
+func setEnumField(f reflect.Value, pw *PiecewiseCoding, v float64) error {
+	if 0 < pw.TextLength {
+		s, errText := pw.textToString(v)
+		if errText != nil {
+			return errText
+		}
+		f.SetString(s)
+		return nil
+	}
+	if v < 0 {
+		return fmt.Errorf("enum %v code is negative %v", pw.Name, v)
+	}
+	name, errName := pw.EnumName(uint64(v))
+	if errName != nil {
+		return errName
+	}
+	f.SetString(name)
+	return nil
+}
+
+func getTimeField(f reflect.Value, pw *PiecewiseCoding) (float64, error) {
+	var timevalue time.Time
+	if f.CanAddr() { //Avoids allocation
+		timevalue = *f.Addr().Interface().(*time.Time)
+	} else {
+		timevalue = f.Interface().(time.Time)
+	}
+	return float64(timevalue.UnixMilli()), nil //Lets use milliseconds for compatibility and overflow reasons with javascript
+}
+
+func setTimeField(f reflect.Value, pw *PiecewiseCoding, v float64) error {
+	*f.Addr().Interface().(*time.Time) = time.UnixMilli(int64(v))
+	return nil
+}
+
+func getDurationField(f reflect.Value, pw *PiecewiseCoding) (float64, error) {
+	return time.Duration(f.Int()).Seconds(), nil
+}
+
+func setDurationField(f reflect.Value, pw *PiecewiseCoding, v float64) error {
+	f.SetInt(int64(math.Round(v * float64(time.Second))))
+	return nil
+}
+
+// optionalAccessors wraps accessors of pointed type. Enums and text use empty code 0 for nil because they have no NaN code
+func optionalAccessors(elemType reflect.Type, get fieldGetter, set fieldSetter) (fieldGetter, fieldSetter) {
+	getOptional := func(f reflect.Value, pw *PiecewiseCoding) (float64, error) {
+		if !f.IsNil() {
+			return get(f.Elem(), pw)
+		}
+		if 0 < len(pw.Enums) || 0 < pw.TextLength {
+			return 0, nil
+		}
+		if pw.Clamped {
+			return 0, fmt.Errorf("%v is nil but clamped coding does not have NaN code for missing value", pw.Name)
+		}
+		return math.NaN(), nil
+	}
+	setOptional := func(f reflect.Value, pw *PiecewiseCoding, v float64) error {
+		if ((0 < len(pw.Enums) || 0 < pw.TextLength) && v == 0) || (math.IsNaN(v) && pw.SpecialName(v) == "") { //Special codes are kept
+			f.Set(reflect.Zero(f.Type()))
+			return nil
+		}
+		if f.IsNil() {
+			f.Set(reflect.New(elemType))
+		}
+		return set(f.Elem(), pw, v)
+	}
+	return getOptional, setOptional
+}
+
+func getUnknownField(f reflect.Value, pw *PiecewiseCoding) (float64, error) {
+	return 0, fmt.Errorf("unknown type %v at %v", f.Type(), f)
+}
+
+func setUnknownField(f reflect.Value, pw *PiecewiseCoding, v float64) error {
+	return fmt.Errorf("unknown type %v", f.Type())
+}
+
+// StructCodec is PiecewiseFloats compiled for one struct type. Field indexes, bit offsets and accessors are resolved once.
+// StructCodec is immutable and safe for concurrent use by many goroutines
+type StructCodec struct {
+	pw           PiecewiseFloats
+	t            reflect.Type
+	plan         *structPlan
+	fields       []codecField //Only non omitted, in bit order
+	numberOfBits int
+}
+
+type codecField struct {
+	coding    *PiecewiseCoding
+	field     *planField  //nil if struct does not have this
+	base      *planField  //epoch of relative time
+	exponent  *codecField //exponent of block when field is block element
+	bitOffset int
+	bits      int
+	maxCode   uint64
+}
+
+var structCodecs sync.Map //reflect.Type -> *StructCodec
+
+// NewStructCodec returns codec for struct type of v (struct or pointer to struct) with splurts directives. Codecs are cached per type
+func NewStructCodec(v interface{}) (*StructCodec, error) {
+	t := reflect.TypeOf(v)
+	if t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("struct or pointer to struct required, got %v", t)
+	}
+	cached, haz := structCodecs.Load(t)
+	if haz {
+		return cached.(*StructCodec), nil
+	}
+	pw, errPw := GetPiecewisesFromStruct(reflect.Zero(t).Interface())
+	if errPw != nil {
+		return nil, errPw
+	}
+	c, errCompile := CompileStructCodec(pw, reflect.Zero(t).Interface())
+	if errCompile != nil {
+		return nil, errCompile
+	}
+	actual, _ := structCodecs.LoadOrStore(t, c)
+	return actual.(*StructCodec), nil
+}
+
+// CompileStructCodec compiles codec for runtime created PiecewiseFloats and struct type of v. Not cached, keep result
+func CompileStructCodec(pw PiecewiseFloats, v interface{}) (*StructCodec, error) {
+	errInv := pw.IsInvalid()
+	if errInv != nil {
+		return nil, errInv
+	}
+	t := reflect.TypeOf(v)
+	if t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil {
+		return nil, fmt.Errorf("struct or pointer to struct required")
+	}
+	plan, errPlan := getStructPlan(t)
+	if errPlan != nil {
+		return nil, errPlan
+	}
+	result := StructCodec{pw: pw.Clone(), t: t, plan: plan}
+	for _, pf := range plan.fields {
+		_, errFound := result.pw.getCoding(pf.Name)
+		if errFound != nil {
+			return nil, errFound
+		}
+	}
+	for i := range result.pw {
+		coding := &result.pw[i]
+		if coding.Omit {
+			continue
+		}
+		bits := coding.NumberOfBits()
+		base, errBase := plan.epochField(coding)
+		if errBase != nil {
+			return nil, errBase
+		}
+		result.fields = append(result.fields, codecField{
+			coding:    coding,
+			field:     plan.field(coding.Name),
+			base:      base,
+			bitOffset: result.numberOfBits,
+			bits:      bits,
+			maxCode:   coding.MaxCode(),
+		})
+		result.numberOfBits += bits
+	}
+	for i := range result.fields { //Elements follow exponent of block
+		if result.fields[i].coding.isBlockElement() {
+			result.fields[i].exponent = result.fields[i-1].exponent
+			if result.fields[i-1].coding.isBlockExponent() {
+				result.fields[i].exponent = &result.fields[i-1]
+			}
+		}
+	}
+	return &result, nil
+}
+
+// Piecewises returns copy of PiecewiseFloats used by codec
+func (c *StructCodec) Piecewises() PiecewiseFloats {
+	return c.pw.Clone()
+}
+
+// NumberOfBits actual bits in record
+func (c *StructCodec) NumberOfBits() int {
+	return c.numberOfBits
+}
+
+// NumberOfBytes record size, padded to full bytes
+func (c *StructCodec) NumberOfBytes() int {
+	return (c.numberOfBits + 7) / 8
+}
+
+func (c *StructCodec) structValue(v interface{}, needPointer bool) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return rv, fmt.Errorf("nil pointer")
+		}
+		rv = rv.Elem()
+	} else if needPointer {
+		return rv, fmt.Errorf("pointer to %v required, got %v", c.t, rv.Type())
+	}
+	if rv.Type() != c.t {
+		return rv, fmt.Errorf("codec is for %v, got %v", c.t, rv.Type())
+	}
+	return rv, nil
+}
+
+// AppendSplurts appends splurtsed input (struct or pointer) to dst. Does not allocate when dst have capacity and input is pointer
+func (c *StructCodec) AppendSplurts(dst []byte, input interface{}) ([]byte, error) {
+	elem, errValue := c.structValue(input, false)
+	if errValue != nil {
+		return dst, errValue
+	}
+	w := BitWriter{buf: dst, start: len(dst)}
+	exponent := math.NaN() //Of latest block
+	for i := range c.fields {
+		cf := &c.fields[i]
+		if cf.coding.isBlockExponent() {
+			maxAbs := math.NaN()
+			for _, element := range c.fields[i+1 : i+1+cf.coding.Block.Count] {
+				if element.field == nil {
+					continue
+				}
+				f, errGet := element.coding.getFieldValue(element.field, nil, elem)
+				if errGet != nil {
+					return dst, errGet
+				}
+				maxAbs = blockMax(maxAbs, f)
+			}
+			w.WriteBits(cf.coding.codeOf(cf.coding.Block.exponentOf(maxAbs), &exponent), cf.bits)
+			continue
+		}
+		if cf.field == nil {
+			errCircular := cf.coding.circularValueIsInvalid(math.NaN())
+			if errCircular != nil {
+				return dst, errCircular
+			}
+			w.WriteBits(cf.coding.missingCode(), cf.bits)
+			continue
+		}
+		f, errGet := cf.coding.getFieldValue(cf.field, cf.base, elem)
+		if errGet != nil {
+			return dst, errGet
+		}
+		errCircular := cf.coding.circularValueIsInvalid(f)
+		if errCircular != nil {
+			return dst, errCircular
+		}
+		w.WriteBits(cf.coding.codeOf(f, &exponent), cf.bits)
+	}
+	return w.buf, nil
+}
+
+// Splurts struct or pointer to struct to new byte array
+func (c *StructCodec) Splurts(input interface{}) ([]byte, error) {
+	return c.AppendSplurts(make([]byte, 0, c.NumberOfBytes()), input)
+}
+
+// decodeField reads and checks code of one field
+func (cf *codecField) decode(r *BitReader) (float64, error) {
+	r.Seek(cf.bitOffset)
+	code, errRead := r.ReadBits(cf.bits)
+	if errRead != nil {
+		return 0, errRead
+	}
+	a := cf.coding
+	if 0 < len(a.Enums) { //Unknown codes are decoded as EnumUnknown
+		code, errRead = a.decodeEnum(code)
+		if errRead != nil {
+			return 0, errRead
+		}
+	}
+	exponent := math.NaN()
+	if cf.exponent != nil {
+		exponent, errRead = cf.exponent.decode(r)
+		if errRead != nil {
+			return 0, errRead
+		}
+	}
+	v := a.valueOf(code, &exponent)
+	if a.ConstDefined && a.Const != v {
+		return v, fmt.Errorf("const field %v is %v not %v", a.Name, v, a.Const)
+	}
+	return v, nil
+}
+
+// UnSplurts decodes raw to output (pointer to struct). Raw is checked before output is modified,
+// but error from setting field (like enum name, marshaler or relative time) can leave output partially set
+func (c *StructCodec) UnSplurts(raw []byte, output interface{}) error {
+	if c.NumberOfBytes() != len(raw) {
+		return fmt.Errorf("Struct have %v bits means %v bytes. BUT binary array have %v bytes", c.numberOfBits, c.NumberOfBytes(), len(raw))
+	}
+	elem, errValue := c.structValue(output, true)
+	if errValue != nil {
+		return errValue
+	}
+	r := BitReader{buf: raw}
+	for i := range c.fields { //Check first
+		_, errDecode := c.fields[i].decode(&r)
+		if errDecode != nil {
+			return errDecode
+		}
+	}
+	for _, relative := range []bool{false, true} { //Relative times after epoch is set
+		for i := range c.fields {
+			cf := &c.fields[i]
+			if cf.field == nil || (cf.base != nil) != relative {
+				continue
+			}
+			v, _ := cf.decode(&r)
+			errSet := cf.coding.setFieldValue(cf.field, cf.base, elem, v)
+			if errSet != nil {
+				return errSet
+			}
+		}
+	}
+	return nil
+}
+
+// DecodeSpecials gives names of special codes on raw by field name. Fields without special code are not on map
+func (c *StructCodec) DecodeSpecials(raw []byte) (map[string]string, error) {
+	return c.pw.DecodeSpecials(raw)
+}
+
+// DecodeValue decodes only one named value from raw by using bit offset
+func (c *StructCodec) DecodeValue(raw []byte, name string) (float64, error) {
+	if c.NumberOfBytes() != len(raw) {
+		return 0, fmt.Errorf("Struct have %v bits means %v bytes. BUT binary array have %v bytes", c.numberOfBits, c.NumberOfBytes(), len(raw))
+	}
+	for i := range c.fields {
+		if c.fields[i].coding.Name == name {
+			r := BitReader{buf: raw}
+			return c.fields[i].decode(&r)
+		}
+	}
+	return 0, fmt.Errorf("name %v not found", name)
+}
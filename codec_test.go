@@ -0,0 +1,159 @@
+package splurts
+
+import (
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStructCodec(t *testing.T) {
+	codec, errCodec := NewStructCodec(AllCases{})
+	assert.Equal(t, nil, errCodec)
+	cached, _ := NewStructCodec(&AllCases{})
+	assert.True(t, codec == cached, "codec must be cached per type")
+
+	recipe, _ := GetPiecewisesFromStruct(AllCases{})
+	assert.Equal(t, recipe.NumberOfBits(), codec.NumberOfBits())
+	assert.Equal(t, recipe.NumberOfBytes(), codec.NumberOfBytes())
+
+	d := AllCases{Alpha: 2.3, Bravo: 10.1, Charlie: 42, Delta: 123, Echo: true, Foxtrot: 13.5, Golf: 5, Hotel: 26.4, Mike: -21.5, Oscar: 42.69}
+	ref, _ := recipe.Splurts(d)
+	byt, errSplurt := codec.Splurts(d)
+	assert.Equal(t, nil, errSplurt)
+	assert.Equal(t, ref, byt)
+
+	back := AllCases{}
+	assert.Equal(t, nil, codec.UnSplurts(byt, &back))
+	refBack := AllCases{}
+	assert.Equal(t, nil, recipe.UnSplurts(byt, &refBack))
+	assert.Equal(t, refBack, back)
+
+	golf, errGolf := codec.DecodeValue(byt, "Golf")
+	assert.Equal(t, nil, errGolf)
+	assert.Equal(t, float64(5), golf)
+	_, errGolf = codec.DecodeValue(byt, "LeaveThisOut")
+	assert.NotEqual(t, nil, errGolf)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		byt, _ = codec.AppendSplurts(byt[:0], &d)
+		codec.UnSplurts(byt, &back)
+	})
+	assert.Equal(t, float64(0), allocs)
+
+	//Misuse
+	assert.NotEqual(t, nil, codec.UnSplurts(byt, back))
+	assert.NotEqual(t, nil, codec.UnSplurts(byt, &ParticleMeas{}))
+	assert.NotEqual(t, nil, codec.UnSplurts(byt[1:], &back))
+	_, errSplurt = codec.Splurts(ParticleMeas{})
+	assert.NotEqual(t, nil, errSplurt)
+	_, errCodec = NewStructCodec([]AllCases{})
+	assert.NotEqual(t, nil, errCodec)
+	_, errCodec = NewStructCodec(Fail0{})
+	assert.NotEqual(t, nil, errCodec)
+
+	//Returned copy does not change codec
+	pw := codec.Piecewises()
+	pw[0].Steps[0].Size = 100
+	again, _ := codec.Splurts(d)
+	assert.Equal(t, ref, again)
+}
+
+func TestStructCodecInvalidRaw(t *testing.T) {
+	codec, errCodec := NewStructCodec(ParticleMeas{})
+	assert.Equal(t, nil, errCodec)
+	d := ParticleMeas{SystemStatus: "IDLE", Temperature: 18.3}
+	byt, _ := codec.Splurts(d)
+	out := ParticleMeas{Temperature: 1}
+	assert.NotEqual(t, nil, codec.UnSplurts(make([]byte, len(byt)), &out))
+	assert.Equal(t, float64(1), out.Temperature, "output must stay untouched on error")
+}
+
+type runtimeStruct struct {
+	Temperature float64
+	Stamp       time.Time
+}
+
+func TestCompileStructCodec(t *testing.T) {
+	pw := PiecewiseFloats{
+		{Name: "Temperature", Min: -40, Steps: []PiecewiseCodingStep{{Size: 0.5, Count: 160}}},
+		{Name: "Stamp", Min: 0, Clamped: true, Steps: []PiecewiseCodingStep{{Size: 1000, Count: DEFAULT_MAXEPOCHMS / 1000}}},
+		{Name: "NotInStruct", Min: 0, Steps: []PiecewiseCodingStep{{Size: 1, Count: 10}}},
+	}
+	codec, errCodec := CompileStructCodec(pw, &runtimeStruct{})
+	assert.Equal(t, nil, errCodec)
+	pw[0].Min = 0 //Codec have own copy
+
+	d := runtimeStruct{Temperature: 21.5, Stamp: time.UnixMilli(1670523401000)}
+	byt, errSplurt := codec.Splurts(&d)
+	assert.Equal(t, nil, errSplurt)
+	back := runtimeStruct{}
+	assert.Equal(t, nil, codec.UnSplurts(byt, &back))
+	assert.Equal(t, d.Temperature, back.Temperature)
+	assert.Equal(t, d.Stamp, back.Stamp)
+	missing, _ := codec.DecodeValue(byt, "NotInStruct")
+	assert.True(t, math.IsNaN(missing))
+
+	_, errCodec = CompileStructCodec(pw[:1], runtimeStruct{})
+	assert.NotEqual(t, nil, errCodec, "field Stamp does not have coding")
+}
+
+func TestStructCodecConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			codec, errCodec := NewStructCodec(ParticleMeas{})
+			if errCodec != nil {
+				t.Error(errCodec)
+				return
+			}
+			buf := make([]byte, 0, codec.NumberOfBytes())
+			for i := 0; i < 200; i++ {
+				d := ParticleMeas{SystemStatus: "MEASURE", Temperature: float64(g), Humidity: float64(i % 100)}
+				var errSplurt error
+				buf, errSplurt = codec.AppendSplurts(buf[:0], &d)
+				if errSplurt != nil {
+					t.Error(errSplurt)
+					return
+				}
+				back := ParticleMeas{}
+				if errUnsplurt := codec.UnSplurts(buf, &back); errUnsplurt != nil {
+					t.Error(errUnsplurt)
+					return
+				}
+				if back.Temperature != d.Temperature || back.Humidity != d.Humidity {
+					t.Errorf("concurrent mismatch %#v vs %#v", back, d)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func BenchmarkStructCodecAppendSplurts(b *testing.B) {
+	_, d := benchmarkRecipe(b)
+	codec, _ := NewStructCodec(AllCases{})
+	buf := make([]byte, 0, codec.NumberOfBytes())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf, _ = codec.AppendSplurts(buf[:0], &d)
+	}
+}
+
+func BenchmarkStructCodecUnSplurts(b *testing.B) {
+	_, d := benchmarkRecipe(b)
+	codec, _ := NewStructCodec(AllCases{})
+	byt, _ := codec.Splurts(d)
+	out := AllCases{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		codec.UnSplurts(byt, &out)
+	}
+}
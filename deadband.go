@@ -0,0 +1,224 @@
+/*
+Report by exception. DeadbandEncoder sends value only when it have changed more than deadband of field since value was last sent.
+DeadbandDecoder keeps state of all values and rebuilds full records.
+Record starts with keyframe bit. Keyframe have codes of all values like normal record. Other records have change mask, one bit per non omitted coding in order, followed by codes of changed values only.
+Fields without deadband directive are sent on every record. Exponent of block is sent when any of its elements is sent
+*/
+
+package splurts
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// DeadbandEncoder codes consecutive records, keeps last sent values
+type DeadbandEncoder struct {
+	KeyframeInterval int //Every Nth record is keyframe. 0 sends keyframe only on first record and when forced
+
+	recipe PiecewiseFloats
+	sent   []float64 //Last sent values, nil when next record is keyframe
+	count  int       //Records since keyframe
+}
+
+// NewDeadbandEncoder creates encoder. Receiver must use DeadbandDecoder with same codings
+func NewDeadbandEncoder(recipe PiecewiseFloats, keyframeInterval int) (*DeadbandEncoder, error) {
+	errInv := recipe.IsInvalid()
+	if errInv != nil {
+		return nil, errInv
+	}
+	if keyframeInterval < 0 {
+		return nil, fmt.Errorf("keyframe interval can not be negative, got %v", keyframeInterval)
+	}
+	return &DeadbandEncoder{KeyframeInterval: keyframeInterval, recipe: recipe.Clone()}, nil
+}
+
+// ForceKeyframe makes next record keyframe, like when receiver have lost its state
+func (e *DeadbandEncoder) ForceKeyframe() {
+	e.sent = nil
+}
+
+// changed tells is value f of coding i changed enough from last sent value
+func (e *DeadbandEncoder) changed(values []float64, i int, f float64) bool {
+	a := &e.recipe[i]
+	if a.isBlockExponent() {
+		for j := i + 1; j < len(e.recipe) && j <= i+a.Block.Count; j++ {
+			if !e.recipe[j].Omit && e.changed(values, j, values[j]) {
+				return true
+			}
+		}
+		return false
+	}
+	if !a.DeadbandDefined {
+		return true
+	}
+	s := e.sent[i]
+	if math.IsNaN(f) || math.IsNaN(s) {
+		return math.IsNaN(f) != math.IsNaN(s) || a.SpecialName(f) != a.SpecialName(s)
+	}
+	if f == s {
+		return false
+	}
+	if math.IsInf(f, 0) || math.IsInf(s, 0) {
+		return true
+	}
+	d := math.Abs(f - s)
+	if a.Circular {
+		d = math.Mod(d, a.Period())
+		d = math.Min(d, a.Period()-d)
+	}
+	return a.Deadband < d
+}
+
+// AppendEncode appends record of values (indexed same way as PiecewiseFloats) to dst. Use NaN for missing values
+func (e *DeadbandEncoder) AppendEncode(dst []byte, values []float64) ([]byte, error) {
+	if len(values) < len(e.recipe) {
+		return dst, fmt.Errorf("have %v codings but only %v values", len(e.recipe), len(values))
+	}
+	errCircular := e.recipe.circularValuesIsInvalid(values)
+	if errCircular != nil {
+		return dst, errCircular
+	}
+	w := BitWriter{buf: dst, start: len(dst)}
+	if e.sent == nil || (0 < e.KeyframeInterval && e.KeyframeInterval <= e.count) {
+		w.WriteBits(1, 1)
+		e.recipe.appendMasked(&w, values, nil)
+		e.sent = make([]float64, len(e.recipe))
+		for i := range e.recipe {
+			e.sent[i] = e.recipe.maskedValue(values, i)
+		}
+		e.count = 1
+		return w.buf, nil
+	}
+	present := make([]bool, len(e.recipe)) //Decided before sent values are updated
+	for i, a := range e.recipe {
+		present[i] = !a.Omit && e.changed(values, i, e.recipe.maskedValue(values, i))
+	}
+	w.WriteBits(0, 1)
+	e.recipe.appendMasked(&w, values, func(i int, f float64) bool { return present[i] })
+	for i := range e.recipe {
+		if present[i] {
+			e.sent[i] = e.recipe.maskedValue(values, i)
+		}
+	}
+	e.count++
+	return w.buf, nil
+}
+
+// Encode codes map of values. Names missing from map are NaN
+func (e *DeadbandEncoder) Encode(values map[string]float64) ([]byte, error) {
+	arr := make([]float64, len(e.recipe))
+	for i, a := range e.recipe {
+		f, haz := values[a.Name]
+		if !haz {
+			f = math.NaN()
+		}
+		arr[i] = f
+	}
+	return e.AppendEncode(nil, arr)
+}
+
+// Splurts codes struct
+func (e *DeadbandEncoder) Splurts(input interface{}) ([]byte, error) {
+	m, errValues := e.recipe.GetValuesToFloatMap(reflect.Indirect(reflect.ValueOf(input)).Interface())
+	if errValues != nil {
+		return nil, errValues
+	}
+	return e.Encode(m)
+}
+
+// IsDeadbandKeyframe tells is record from DeadbandEncoder keyframe
+func IsDeadbandKeyframe(raw []byte) bool {
+	return 0 < len(raw) && raw[0]&0x80 != 0
+}
+
+// DeadbandDecoder decodes records of DeadbandEncoder, keeps state of all values
+type DeadbandDecoder struct {
+	recipe PiecewiseFloats
+	state  []float64 //nil until keyframe is received
+}
+
+// NewDeadbandDecoder creates decoder. Records are rejected until first keyframe
+func NewDeadbandDecoder(recipe PiecewiseFloats) (*DeadbandDecoder, error) {
+	errInv := recipe.IsInvalid()
+	if errInv != nil {
+		return nil, errInv
+	}
+	return &DeadbandDecoder{recipe: recipe.Clone()}, nil
+}
+
+// Reset drops state. Records are rejected until next keyframe
+func (d *DeadbandDecoder) Reset() {
+	d.state = nil
+}
+
+// update decodes record to state. State is not changed on error
+func (d *DeadbandDecoder) update(raw []byte) error {
+	if len(raw) == 0 {
+		return fmt.Errorf("empty record")
+	}
+	keyframe := IsDeadbandKeyframe(raw)
+	if !keyframe && d.state == nil {
+		return fmt.Errorf("no keyframe received")
+	}
+	next := make([]float64, len(d.recipe))
+	if keyframe {
+		for i := range next {
+			next[i] = math.NaN()
+		}
+	} else {
+		copy(next, d.state)
+	}
+	errDecode := d.recipe.decodeMaskedEach(raw, 1, keyframe, func(i int, a *PiecewiseCoding, v float64) error {
+		next[i] = v
+		return nil
+	})
+	if errDecode != nil {
+		return errDecode
+	}
+	d.state = next
+	return nil
+}
+
+// DecodeInto updates state from record and copies all values to values indexed same way as PiecewiseFloats.
+// Omitted values are left untouched
+func (d *DeadbandDecoder) DecodeInto(raw []byte, values []float64) error {
+	if len(values) < len(d.recipe) {
+		return fmt.Errorf("have %v codings but only %v values", len(d.recipe), len(values))
+	}
+	errUpdate := d.update(raw)
+	if errUpdate != nil {
+		return errUpdate
+	}
+	for i, a := range d.recipe {
+		if !a.Omit {
+			values[i] = d.state[i]
+		}
+	}
+	return nil
+}
+
+// Decode updates state from record and gives all values as map
+func (d *DeadbandDecoder) Decode(raw []byte, allowNaN bool) (map[string]float64, error) {
+	errUpdate := d.update(raw)
+	if errUpdate != nil {
+		return nil, errUpdate
+	}
+	result := make(map[string]float64)
+	for i, a := range d.recipe {
+		if !a.Omit && (!math.IsNaN(d.state[i]) || allowNaN) {
+			result[a.Name] = d.state[i]
+		}
+	}
+	return result, nil
+}
+
+// UnSplurts updates state from record and sets all fields of output (pointer to struct)
+func (d *DeadbandDecoder) UnSplurts(raw []byte, output interface{}) error {
+	errUpdate := d.update(raw)
+	if errUpdate != nil {
+		return errUpdate
+	}
+	return d.recipe.setFieldsFromValues(output, d.state)
+}
@@ -0,0 +1,134 @@
+package splurts
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type CellularMeas struct {
+	Temp    float64 `splurts:"min=-40,max=85,step=0.5,deadband=1"`
+	Count   int     `splurts:"min=0,max=1000,step=1"`
+	Mode    string  `splurts:"deadband=0,enum=IDLE,RUN"`
+	Heading float64 `splurts:"circular,min=0,max=360,step=1,deadband=5"`
+}
+
+type CellularTracker struct {
+	Pos [2]float64 `splurts:"geo,precision=1m,bbox=60 20|70 30,deadband=10"`
+}
+
+type CellularImu struct {
+	Acc  [3]float64 `splurts:"block=10,step=0.01,max=160,deadband=0.1"`
+	Temp float64    `splurts:"min=-40,max=85,step=0.5,deadband=1"`
+}
+
+func TestDeadband(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(CellularMeas{})
+	assert.Equal(t, nil, errRecipe)
+	assert.Equal(t, 1.0, recipe[0].Deadband)
+	assert.False(t, recipe[1].DeadbandDefined)
+	assert.True(t, recipe[2].DeadbandDefined)
+	bits := recipe.NumberOfBits()
+
+	enc, errEnc := NewDeadbandEncoder(recipe, 3)
+	assert.Equal(t, nil, errEnc)
+	dec, errDec := NewDeadbandDecoder(recipe)
+	assert.Equal(t, nil, errDec)
+
+	d := CellularMeas{Temp: 20, Count: 1, Mode: "RUN", Heading: 358}
+	keyframe, errSplurt := enc.Splurts(&d)
+	assert.Equal(t, nil, errSplurt)
+	assert.True(t, IsDeadbandKeyframe(keyframe))
+	assert.Equal(t, (1+bits+7)/8, len(keyframe))
+	back := CellularMeas{}
+	assert.Equal(t, nil, dec.UnSplurts(keyframe, &back))
+	assert.Equal(t, d, back)
+
+	d = CellularMeas{Temp: 20.5, Count: 2, Mode: "RUN", Heading: 2}
+	delta, errSplurt := enc.Splurts(&d)
+	assert.Equal(t, nil, errSplurt)
+	assert.False(t, IsDeadbandKeyframe(delta))
+	assert.Equal(t, 2, len(delta), "keyframe bit, 4 bit mask and count")
+	assert.Equal(t, nil, dec.UnSplurts(delta, &back))
+	assert.Equal(t, CellularMeas{Temp: 20, Count: 2, Mode: "RUN", Heading: 358}, back, "heading wraps around within deadband")
+
+	d = CellularMeas{Temp: 21.5, Count: 3, Mode: "IDLE", Heading: 10}
+	delta, _ = enc.Splurts(&d)
+	m, errDecode := dec.Decode(delta, true)
+	assert.Equal(t, nil, errDecode)
+	assert.Equal(t, 21.5, m["Temp"], "change from last sent value")
+	assert.Equal(t, 1.0, m["Mode"])
+	assert.Equal(t, 10.0, m["Heading"])
+
+	keyframe, _ = enc.Splurts(&d)
+	assert.True(t, IsDeadbandKeyframe(keyframe), "every third record")
+	delta, _ = enc.Splurts(&d)
+	assert.False(t, IsDeadbandKeyframe(delta))
+	enc.ForceKeyframe()
+	forced, _ := enc.Splurts(&d)
+	assert.True(t, IsDeadbandKeyframe(forced))
+
+	fresh, _ := NewDeadbandDecoder(recipe)
+	assert.NotEqual(t, nil, fresh.UnSplurts(delta, &back), "no keyframe received")
+	values := make([]float64, len(recipe))
+	assert.Equal(t, nil, fresh.DecodeInto(keyframe, values))
+	assert.Equal(t, nil, fresh.DecodeInto(delta, values))
+	assert.Equal(t, []float64{21.5, 3, 1}, values[:3])
+	assert.NotEqual(t, nil, fresh.DecodeInto(append(delta, 0), values), "extra bytes")
+	fresh.Reset()
+	assert.NotEqual(t, nil, fresh.DecodeInto(delta, values))
+
+	_, errSplurt = enc.Splurts(&CellularMeas{Heading: math.NaN()})
+	assert.NotEqual(t, nil, errSplurt, "circular does not have NaN code")
+
+	_, errNegative := NewDeadbandEncoder(recipe, -1)
+	assert.NotEqual(t, nil, errNegative)
+}
+
+func TestDeadbandGeo(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(CellularTracker{})
+	assert.Equal(t, nil, errRecipe)
+	metres := EARTHRADIUS * math.Pi / 180
+	assert.InDelta(t, 10, recipe[0].Deadband*metres, 1e-9)
+	assert.InDelta(t, 10, recipe[1].Deadband*metres*math.Cos(60*math.Pi/180), 1e-9, "same scaling as longitude step")
+
+	enc, _ := NewDeadbandEncoder(recipe, 0)
+	d := CellularTracker{Pos: [2]float64{60.0001, 25}}
+	_, errSplurt := enc.Splurts(&d)
+	assert.Equal(t, nil, errSplurt)
+	east := 1 / (metres * math.Cos(60.0001*math.Pi/180)) //Degrees of longitude per metre at 60°N
+	d.Pos[1] += 8 * east
+	byt, _ := enc.Splurts(&d)
+	assert.Equal(t, 1, len(byt), "8 m east is within deadband")
+	d.Pos[1] += 4 * east
+	byt, _ = enc.Splurts(&d)
+	assert.Equal(t, (1+2+recipe[1].NumberOfBits()+7)/8, len(byt), "12 m east is sent")
+}
+
+func TestDeadbandBlock(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(CellularImu{})
+	assert.Equal(t, nil, errRecipe)
+	enc, _ := NewDeadbandEncoder(recipe, 0)
+	dec, _ := NewDeadbandDecoder(recipe)
+
+	d := CellularImu{Acc: [3]float64{9.81, -0.5, 0.02}, Temp: 21}
+	byt, errSplurt := enc.Splurts(&d)
+	assert.Equal(t, nil, errSplurt)
+	back := CellularImu{}
+	assert.Equal(t, nil, dec.UnSplurts(byt, &back))
+
+	d.Acc[2] = 0.05
+	byt, _ = enc.Splurts(&d)
+	assert.Equal(t, 1, len(byt), "only mask")
+	assert.Equal(t, nil, dec.UnSplurts(byt, &back))
+	assert.Equal(t, 0.03125, back.Acc[2])
+
+	d.Acc[1] = -2
+	d.Temp = math.NaN()
+	byt, _ = enc.Splurts(&d)
+	assert.Equal(t, (1+5+3+10+8+7)/8, len(byt), "exponent is sent with element")
+	assert.Equal(t, nil, dec.UnSplurts(byt, &back))
+	assert.Equal(t, [3]float64{9.8125, -2, 0.03125}, back.Acc)
+	assert.True(t, math.IsNaN(back.Temp), "value becoming missing is sent")
+}
@@ -11,18 +11,37 @@ import (
 
 // Keywords in struct. Fixed, based on what kind hardware measures and where
 const (
-	SPLURTS          = "splurts"
-	DIRECTIVECLAMPED = "clamped"
-	DIRECTIVEMIN     = "min"
-	DIRECTIVEMAX     = "max"
-	DIRECTIVESTEP    = "step"
-	DIRECTIVESTEPS   = "steps"
-	DIRECTIVEBITS    = "bits"   //Use instead of step or steps
-	DIRECTIVEENUM    = "enum"   //Used for string datatypes, array of strings of names
-	DIRECTIVEINFPOS  = "infpos" //Override inf+ value
-	DIRECTIVEINFNEG  = "infneg" //Override inf- value
-	DIRECTIVECONST   = "const"  //constant value, set when splurtsing to binary. Required when converting to binary
-	DIRECTIVEOMIT    = "omit"   //do not splurt or unsplurt this variable
+	SPLURTS            = "splurts"
+	DIRECTIVECLAMPED   = "clamped"
+	DIRECTIVEMIN       = "min"
+	DIRECTIVEMAX       = "max"
+	DIRECTIVESTEP      = "step"
+	DIRECTIVESTEPS     = "steps"
+	DIRECTIVEBITS      = "bits"      //Use instead of step or steps
+	DIRECTIVEENUM      = "enum"      //Used for string datatypes, array of strings of names. Codes can be given like enum=IDLE:1,RUN:5. Must be last directive
+	DIRECTIVEUNKNOWN   = "unknown"   //Enum used for unknown strings and codes, like unknown=OTHER. Must be before enum directive
+	DIRECTIVEINFPOS    = "infpos"    //Override inf+ value
+	DIRECTIVEINFNEG    = "infneg"    //Override inf- value
+	DIRECTIVECONST     = "const"     //constant value, set when splurtsing to binary. Required when converting to binary
+	DIRECTIVEOMIT      = "omit"      //do not splurt or unsplurt this variable
+	DIRECTIVEEPOCH     = "epoch"     //time.Time used as base of relative time fields. Can be omitted and sent once per batch
+	DIRECTIVERELATIVE  = "relative"  //time.Time coded as milliseconds from epoch field
+	DIRECTIVELOG       = "log"       //Quantize in log space, constant relative precision
+	DIRECTIVERELSTEP   = "relstep"   //Relative step size of log coding like 1% or 0.01
+	DIRECTIVETABLE     = "table"     //Calibration table of code value pairs like table=100 125|1000 60|4095 -40
+	DIRECTIVEROUND     = "round"     //Rounding mode nearest (default), floor, ceil or dither
+	DIRECTIVESPECIAL   = "special"   //Named special codes like special=DISCONNECTED,WARMUP. Names continue until next directive
+	DIRECTIVEFLAGS     = "flags"     //Bit flag set on integer or []string field like flags=HEATER,FAN,ALARM. Names continue until next directive
+	DIRECTIVETEXT      = "text"      //Fixed length text on string field, max number of characters like text=8
+	DIRECTIVEALPHABET  = "alphabet"  //Alphabet of text, sixbit (default), baudot or ascii
+	DIRECTIVECIRCULAR  = "circular"  //Value wraps around from max to min like angle. No NaN or ±inf codes
+	DIRECTIVEGEO       = "geo"       //Geo position on [2]float64 (lat,lon) or struct with Lat and Lon fields. Coded as Field.Lat and Field.Lon
+	DIRECTIVEPRECISION = "precision" //Distance between codes of geo position like precision=5m, km and cm are also accepted
+	DIRECTIVEBBOX      = "bbox"      //Bounding box of geo position like bbox=59.8 24.5|60.4 25.3 (minlat minlon|maxlat maxlon)
+	DIRECTIVEBLOCK     = "block"     //Block floating point on float array or struct, mantissa bits with sign like block=10. Requires step and max
+	DIRECTIVEFLOAT     = "float"     //Reduced precision float for unknown range, float=16 (half), float=bf16 or float=32
+	DIRECTIVEMINIFLOAT = "minifloat" //Minifloat with exponent and mantissa bits like minifloat=e4m3 or minifloat=e5m2
+	DIRECTIVEDEADBAND  = "deadband"  //Report by exception, value is sent when it changes more than deadband like deadband=0.5. Used by DeadbandEncoder
 
 	DIRECTIVE_META_UNIT    = "unit"    //Unit like kg. Used when plotting and grouping "compatible" metrics together
 	DIRECTIVE_META_CAPTION = "caption" //Caption for this metric, optional. Printable text without unit
@@ -35,6 +54,8 @@ const (
 const (
 	DEFAULT_MINEPOCHMS = 0 //1600000000000
 	DEFAULT_MAXEPOCHMS = 4300000000000
+
+	DEFAULT_MAXRELATIVEMS = 24 * 60 * 60 * 1000 //Relative time covers one day by default
 )
 
 type DirectiveMetadata struct { //Metadata for plotting, printing, reporting, exporting etc... Not directly for computing values
@@ -70,8 +91,40 @@ type DirectiveSettings struct { //For parsed
 	InfPos        float64
 	InfNeg        float64
 
-	Enums []string
-	Const string
+	Enums       []string
+	EnumCodes   []uint64
+	EnumUnknown string
+	Const       string
+
+	Epoch    bool
+	Relative bool
+
+	Log     bool
+	RelStep float64
+
+	Table []CalibrationPoint
+
+	Rounding RoundingMode
+
+	Specials []string
+	Flags    []string
+
+	TextLength int
+	Alphabet   string
+
+	Circular bool
+
+	Geo          bool
+	GeoPrecision float64 //metres
+	GeoBox       *GeoBox //nil is whole world
+
+	BlockMantissa int //Bits of element mantissa on block floating point
+
+	FloatExponent int //Exponent bits of reduced precision float, 0 is not float
+	FloatMantissa int
+
+	Deadband        float64
+	DeadbandDefined bool
 
 	Meta DirectiveMetadata
 }
@@ -106,6 +159,21 @@ func parseByTypenameToFloat64(s string, typename string) (float64, error) {
 	case "int64":
 		i, errconst := strconv.ParseUint(s, 0, 64)
 		return float64(i), errconst
+	case "uint", "uint32":
+		i, errconst := strconv.ParseUint(s, 0, 32)
+		return float64(i), errconst
+	case "uint8":
+		i, errconst := strconv.ParseUint(s, 0, 8)
+		return float64(i), errconst
+	case "uint16":
+		i, errconst := strconv.ParseUint(s, 0, 16)
+		return float64(i), errconst
+	case "uint64":
+		i, errconst := strconv.ParseUint(s, 0, 64)
+		return float64(i), errconst
+	case typenameDuration:
+		d, errconst := time.ParseDuration(s)
+		return d.Seconds(), errconst
 	case "bool":
 		b, errconst := strconv.ParseBool(s)
 		if b {
@@ -117,10 +185,46 @@ func parseByTypenameToFloat64(s string, typename string) (float64, error) {
 	}
 }
 
+// parseDirectiveNumber parses min, max and step values. Durations are coded as seconds and can be given like 10ms or 1h.
+// Times are in milliseconds, duration syntax is also accepted
+func parseDirectiveNumber(s string, typename string) (float64, error) {
+	switch typename {
+	case typenameDuration:
+		d, errDuration := time.ParseDuration(s)
+		if errDuration == nil {
+			return d.Seconds(), nil
+		}
+	case typenameTime:
+		d, errDuration := time.ParseDuration(s)
+		if errDuration == nil {
+			return float64(d.Milliseconds()), nil
+		}
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// parsePercent parses number like 0.01 or 1%
+func parsePercent(s string) (float64, error) {
+	if strings.HasSuffix(s, "%") {
+		f, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		return f / 100, err
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// isBareDirective tells is token directive without value. Those end list of special or flag names
+func isBareDirective(tok string) bool {
+	switch tok {
+	case DIRECTIVECLAMPED, DIRECTIVEOMIT, DIRECTIVELOG, DIRECTIVECIRCULAR, DIRECTIVEGEO, DIRECTIVEEPOCH, DIRECTIVERELATIVE:
+		return true
+	}
+	return false
+}
+
 func parseDirectives(tag string, typename string) (DirectiveSettings, error) {
 	result := DirectiveSettings{}
 
-	if typename == "Time" {
+	if typename == typenameTime {
 		//Lets set some good defaults
 		//result.Bits = 64
 		result.Step = 1.0
@@ -139,6 +243,7 @@ func parseDirectives(tag string, typename string) (DirectiveSettings, error) {
 
 	//Default step is 1
 	result.Step = 1.0
+	var list *[]string //Special or flag names continue until next directive
 	for tokindex, tok := range maintokens {
 		eqsplit := strings.Split(tok, "=")
 		if (len(eqsplit) != 2) && (len(eqsplit) != 1) {
@@ -146,22 +251,54 @@ func parseDirectives(tag string, typename string) (DirectiveSettings, error) {
 		}
 
 		if eqsplit[0] == DIRECTIVEENUM {
-			result.Enums = maintokens[tokindex:]
-			result.Enums[0] = strings.Replace(result.Enums[0], DIRECTIVEENUM, "", 1)
-			result.Enums[0] = strings.Replace(result.Enums[0], "=", "", 1)
+			tokens := append([]string(nil), maintokens[tokindex:]...)
+			tokens[0] = strings.Replace(tokens[0], DIRECTIVEENUM, "", 1)
+			tokens[0] = strings.Replace(tokens[0], "=", "", 1)
+			var errEnums error
+			result.Enums, result.EnumCodes, errEnums = parseEnums(tokens, isIntegerTypename(typename))
+			if errEnums != nil {
+				return result, fmt.Errorf("invalid tag %v, %v", tag, errEnums.Error())
+			}
+			maxCode := uint64(len(result.Enums))
+			for _, code := range result.EnumCodes {
+				if maxCode < code {
+					maxCode = code
+				}
+			}
 			result.Steps = []PiecewiseCodingStep{
-				{Size: 1, Count: uint64(len(result.Enums))},
+				{Size: 1, Count: maxCode},
 			}
 			result.Clamped = true
 			return result, nil
 		}
 
+		if len(eqsplit) == 2 || isBareDirective(tok) {
+			list = nil
+		}
+		if len(eqsplit) == 1 && list != nil {
+			*list = append(*list, tok)
+			continue
+		}
+
 		if len(eqsplit) == 1 {
 			switch eqsplit[0] { //Too many
 			case DIRECTIVECLAMPED:
 				result.Clamped = true
 			case DIRECTIVEOMIT:
 				result.Omit = true
+			case DIRECTIVELOG:
+				result.Log = true
+			case DIRECTIVECIRCULAR:
+				result.Circular = true
+				result.Clamped = true
+			case DIRECTIVEGEO:
+				result.Geo = true
+			case DIRECTIVEEPOCH, DIRECTIVERELATIVE:
+				if typename != typenameTime {
+					return result, fmt.Errorf("invalid tag %v, %v is only for time.Time", tag, tok)
+				}
+				result.Epoch = result.Epoch || tok == DIRECTIVEEPOCH
+				result.Relative = result.Relative || tok == DIRECTIVERELATIVE
 			default:
 				return result, fmt.Errorf("invalid tag %v, unknown token %v", tag, tok)
 			}
@@ -177,7 +314,7 @@ func parseDirectives(tag string, typename string) (DirectiveSettings, error) {
 				}
 
 			case DIRECTIVEINFPOS:
-				f, ferr := strconv.ParseFloat(eqsplit[1], 64)
+				f, ferr := parseDirectiveNumber(eqsplit[1], typename)
 				if ferr != nil {
 					return result, fmt.Errorf("invalid tag %v, invalid token %v parse error %v", tag, tok, ferr.Error())
 				}
@@ -185,7 +322,7 @@ func parseDirectives(tag string, typename string) (DirectiveSettings, error) {
 				result.InfPosDefined = true
 
 			case DIRECTIVEINFNEG:
-				f, ferr := strconv.ParseFloat(eqsplit[1], 64)
+				f, ferr := parseDirectiveNumber(eqsplit[1], typename)
 				if ferr != nil {
 					return result, fmt.Errorf("invalid tag %v, invalid token %v parse error %v", tag, tok, ferr.Error())
 				}
@@ -193,14 +330,14 @@ func parseDirectives(tag string, typename string) (DirectiveSettings, error) {
 				result.InfNegDefined = true
 
 			case DIRECTIVEMIN:
-				f, ferr := strconv.ParseFloat(eqsplit[1], 64)
+				f, ferr := parseDirectiveNumber(eqsplit[1], typename)
 				if ferr != nil {
 					return result, fmt.Errorf("invalid tag %v, invalid token %v parse error %v", tag, tok, ferr.Error())
 				}
 				result.Min = f
 				result.MinDefined = true
 			case DIRECTIVEMAX:
-				f, ferr := strconv.ParseFloat(eqsplit[1], 64)
+				f, ferr := parseDirectiveNumber(eqsplit[1], typename)
 				if ferr != nil {
 					return result, fmt.Errorf("invalid tag %v, invalid token %v parse error %v", tag, tok, ferr.Error())
 				}
@@ -208,12 +345,83 @@ func parseDirectives(tag string, typename string) (DirectiveSettings, error) {
 				result.MaxDefined = true
 			case DIRECTIVESTEP:
 
-				f, ferr := strconv.ParseFloat(eqsplit[1], 64)
+				f, ferr := parseDirectiveNumber(eqsplit[1], typename)
 				if ferr != nil {
 					return result, fmt.Errorf("invalid tag %v, invalid token %v parse error %v", tag, tok, ferr.Error())
 				}
 				result.Step = f
 
+			case DIRECTIVETABLE:
+				var errTable error
+				result.Table, errTable = parseCalibrationTable(eqsplit[1])
+				if errTable != nil {
+					return result, fmt.Errorf("invalid tag %v, invalid token %v %v", tag, tok, errTable.Error())
+				}
+			case DIRECTIVEUNKNOWN:
+				result.EnumUnknown = eqsplit[1]
+			case DIRECTIVESPECIAL:
+				result.Specials = []string{eqsplit[1]}
+				list = &result.Specials
+			case DIRECTIVEFLAGS:
+				result.Flags = []string{eqsplit[1]}
+				list = &result.Flags
+			case DIRECTIVETEXT:
+				n, errN := strconv.Atoi(eqsplit[1])
+				if errN != nil || n <= 0 {
+					return result, fmt.Errorf("invalid tag %v, invalid token %v, text length must be positive", tag, tok)
+				}
+				result.TextLength = n
+			case DIRECTIVEALPHABET:
+				result.Alphabet = eqsplit[1]
+			case DIRECTIVEPRECISION:
+				f, ferr := parseDistance(eqsplit[1])
+				if ferr != nil {
+					return result, fmt.Errorf("invalid tag %v, invalid token %v parse error %v", tag, tok, ferr.Error())
+				}
+				result.GeoPrecision = f
+			case DIRECTIVEFLOAT, DIRECTIVEMINIFLOAT:
+				var errFormat error
+				result.FloatExponent, result.FloatMantissa, errFormat = ParseFloatFormat(eqsplit[1])
+				if errFormat != nil {
+					return result, fmt.Errorf("invalid tag %v, %v", tag, errFormat.Error())
+				}
+			case DIRECTIVEBLOCK:
+				n, errN := strconv.Atoi(eqsplit[1])
+				if errN != nil || n < 2 || MAXMANTISSABITS < n {
+					return result, fmt.Errorf("invalid tag %v, invalid token %v, block mantissa must be 2..%v bits", tag, tok, MAXMANTISSABITS)
+				}
+				result.BlockMantissa = n
+			case DIRECTIVEBBOX:
+				box, errBox := parseGeoBox(eqsplit[1])
+				if errBox != nil {
+					return result, fmt.Errorf("invalid tag %v, %v", tag, errBox.Error())
+				}
+				result.GeoBox = &box
+			case DIRECTIVEROUND:
+				mode, errMode := ParseRoundingMode(eqsplit[1])
+				if errMode != nil {
+					return result, fmt.Errorf("invalid tag %v, %v", tag, errMode.Error())
+				}
+				result.Rounding = mode
+			case DIRECTIVEDEADBAND:
+				f, ferr := parseDirectiveNumber(eqsplit[1], typename)
+				if ferr != nil {
+					return result, fmt.Errorf("invalid tag %v, invalid token %v parse error %v", tag, tok, ferr.Error())
+				}
+				if f < 0 || math.IsNaN(f) {
+					return result, fmt.Errorf("invalid tag %v, deadband can not be negative", tag)
+				}
+				result.Deadband = f
+				result.DeadbandDefined = true
+			case DIRECTIVERELSTEP:
+				f, ferr := parsePercent(eqsplit[1])
+				if ferr != nil {
+					return result, fmt.Errorf("invalid tag %v, invalid token %v parse error %v", tag, tok, ferr.Error())
+				}
+				if f <= 0 {
+					return result, fmt.Errorf("invalid tag %v, relative step must be positive", tag)
+				}
+				result.RelStep = f
 			case DIRECTIVEBITS:
 				bts, parseError := strconv.ParseInt(eqsplit[1], 10, 8)
 				if parseError != nil {
@@ -231,7 +439,7 @@ func parseDirectives(tag string, typename string) (DirectiveSettings, error) {
 					if len(sizecountArr) != 2 {
 						return result, fmt.Errorf("invalid tag %v, invalid token %v Only size|count pairs NOT %#v", tag, tok, sStep)
 					}
-					stepSize, parseErrSize := strconv.ParseFloat(sizecountArr[0], 64)
+					stepSize, parseErrSize := parseDirectiveNumber(sizecountArr[0], typename)
 					stepCount, parseErrCount := strconv.ParseInt(sizecountArr[1], 10, 64)
 					if parseErrSize != nil || parseErrCount != nil {
 						return result, fmt.Errorf("invalid tag %v, invalid token %v  error on token step %v", tag, tok, nStep)
@@ -260,6 +468,17 @@ func parseDirectives(tag string, typename string) (DirectiveSettings, error) {
 	if result.Clamped && (result.InfPosDefined || result.InfNegDefined) {
 		return result, fmt.Errorf("clamped and infpos/infneg can not be defined at same time")
 	}
+	if result.Epoch && result.Relative {
+		return result, fmt.Errorf("epoch can not be relative")
+	}
+	if result.Relative { //Offset from epoch instead of absolute time
+		if !result.MinDefined {
+			result.Min = 0
+		}
+		if !result.MaxDefined {
+			result.Max = DEFAULT_MAXRELATIVEMS
+		}
+	}
 	return result, nil
 }
 
@@ -283,14 +502,36 @@ func createPiecewiseCodingFromStruct(name string, typename string, tag string) (
 		Clamped: dir.Clamped,
 		Enums:   dir.Enums,
 
+		EnumCodes:   dir.EnumCodes,
+		EnumUnknown: dir.EnumUnknown,
+
+		Flags: dir.Flags,
+
+		TextLength: dir.TextLength,
+		Alphabet:   dir.Alphabet,
+
 		InfPosDefined: dir.InfPosDefined,
 		InfNegDefined: dir.InfNegDefined,
 		InfPos:        dir.InfPos,
 		InfNeg:        dir.InfNeg,
 
+		Epoch: dir.Epoch,
+		Log:   dir.Log,
+		Table: dir.Table,
+
+		Rounding: dir.Rounding,
+		Specials: dir.Specials,
+		Circular: dir.Circular,
+
+		Deadband:        dir.Deadband,
+		DeadbandDefined: dir.DeadbandDefined,
+
 		//Const: dir.Const,
 		Meta: dir.Meta,
 	}
+	if typename == typenameDuration && result.Meta.Unit == "" {
+		result.Meta.Unit = "s" //Durations are coded as seconds
+	}
 
 	if 0 < len(dir.Const) {
 		var parseErr error
@@ -301,6 +542,60 @@ func createPiecewiseCodingFromStruct(name string, typename string, tag string) (
 		result.ConstDefined = true
 	}
 
+	if 0 < dir.BlockMantissa {
+		return result, fmt.Errorf("%v block requires array of floats or struct with only float fields, not %v", name, typename)
+	}
+
+	if dir.Geo {
+		return result, fmt.Errorf("%v geo position requires [2]float64 (lat,lon) or struct with Lat and Lon float fields, not %v", name, typename)
+	}
+
+	if dir.EnumUnknown != "" && len(dir.Enums) == 0 {
+		return result, fmt.Errorf("%v have %v directive without enums", name, DIRECTIVEUNKNOWN)
+	}
+	if 0 < len(result.Enums) {
+		errEnums := result.enumsIsInvalid()
+		if errEnums != nil {
+			return result, errEnums
+		}
+	}
+
+	if 0 < len(result.Flags) || typename == typenameFlags {
+		return flagsCoding(result, typename)
+	}
+
+	if 0 < result.TextLength || result.Alphabet != "" {
+		return textCoding(result, typename)
+	}
+
+	if result.Circular {
+		return circularCoding(result, dir, typename)
+	}
+
+	if 0 < dir.FloatExponent {
+		return floatCoding(result, dir, typename)
+	}
+
+	if 0 < len(result.Specials) {
+		if typename != "float64" && typename != "float32" {
+			return result, fmt.Errorf("%v special codes are decoded as NaN and require float field, not %v", name, typename)
+		}
+		errSpecial := result.specialsIsInvalid()
+		if errSpecial != nil {
+			return result, errSpecial
+		}
+	}
+
+	if 0 < len(result.Table) {
+		errTable := result.tableIsInvalid()
+		if errTable != nil {
+			return result, errTable
+		}
+		lowest, _ := result.tableRange()
+		result.Min = lowest.Value //Informative, table is used for coding
+		return result, nil
+	}
+
 	if 0 < len(result.Steps) {
 		return result, nil //OK
 	}
@@ -309,15 +604,14 @@ func createPiecewiseCodingFromStruct(name string, typename string, tag string) (
 		return result, nil
 	}
 
+	if dir.Log {
+		return logCoding(result, dir)
+	}
+
 	steps := int(0)
 	if 1 < dir.Bits { //ok, calc from bits
-		if result.Clamped {
-			//is already clamped
-			steps = int(math.Pow(2, float64(dir.Bits)))
-		} else {
-			//NaN, -inf and +inf are needed
-			steps = int(math.Pow(2, float64(dir.Bits))) - 3
-		}
+		//NaN, -inf, +inf and special codes are needed when not clamped
+		steps = int(math.Pow(2, float64(dir.Bits))) - int(result.reservedCodes())
 		if !dir.MaxDefined {
 			dir.Max = dir.Step*float64(steps) + dir.Min
 		}
@@ -329,62 +623,298 @@ func createPiecewiseCodingFromStruct(name string, typename string, tag string) (
 	return result, nil
 }
 
-// GetPiecewisesFromStruct parses by reflect all datatypes with directives to PiecewiseFloats
+// logCoding calculates step count from relstep or relative step size from bits
+func logCoding(result PiecewiseCoding, dir DirectiveSettings) (PiecewiseCoding, error) {
+	if !dir.MinDefined || !dir.MaxDefined || dir.Min <= 0 || dir.Max <= dir.Min {
+		return result, fmt.Errorf("%v log coding requires positive min and max > min", result.Name)
+	}
+	logSpan := math.Log(dir.Max / dir.Min)
+	switch {
+	case 0 < dir.RelStep:
+		result.Steps = []PiecewiseCodingStep{{Size: dir.RelStep, Count: uint64(math.Ceil(logSpan / math.Log1p(dir.RelStep)))}}
+	case 1 < dir.Bits:
+		steps := uint64(1)<<uint(dir.Bits) - result.reservedCodes() //NaN, -inf, +inf and special codes are needed when not clamped
+		result.Steps = []PiecewiseCodingStep{{Size: math.Expm1(logSpan / float64(steps)), Count: steps}}
+	default:
+		return result, fmt.Errorf("%v log coding requires relstep or bits", result.Name)
+	}
+	return result, nil
+}
+
+// flagsCoding codes one bit per flag. Integer field must have bit for each flag
+func flagsCoding(result PiecewiseCoding, typename string) (PiecewiseCoding, error) {
+	if len(result.Flags) == 0 {
+		return result, fmt.Errorf("%v %v field requires %v directive", result.Name, typename, DIRECTIVEFLAGS)
+	}
+	maxFlags := MAXFLAGS
+	if typename != typenameFlags {
+		size, haz := integerBits[typename]
+		if !haz {
+			return result, fmt.Errorf("%v flags require integer or []string field, not %v", result.Name, typename)
+		}
+		if strings.HasPrefix(typename, "int") {
+			size-- //Sign bit is not used
+		}
+		if size < maxFlags {
+			maxFlags = size
+		}
+	}
+	if maxFlags < len(result.Flags) {
+		return result, fmt.Errorf("%v have %v flags, %v can have %v", result.Name, len(result.Flags), typename, maxFlags)
+	}
+	result.Clamped = true
+	result.Min = 0
+	result.Steps = []PiecewiseCodingStep{{Size: 1, Count: 1<<uint(len(result.Flags)) - 1}}
+	return result, result.flagsIsInvalid()
+}
+
+// GetPiecewisesFromStruct parses by reflect all datatypes with directives to PiecewiseFloats.
+// Nested structs are flattened with dotted names like Env.Temp, fields of embedded structs are promoted without prefix.
+// Elements of fixed size arrays are named like Ch[3] and share directives of array field
 func GetPiecewisesFromStruct(v interface{}) (PiecewiseFloats, error) {
 	result := []PiecewiseCoding{}
-	t := reflect.TypeOf(v)
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
-		if field.Type.Name() != "" {
-
-			coding, codingErr := createPiecewiseCodingFromStruct(field.Name, field.Type.Name(), field.Tag.Get(SPLURTS))
+	leaves, errFlatten := flattenStruct(reflect.TypeOf(v))
+	if errFlatten != nil {
+		return result, errFlatten
+	}
+	relatives := []int{} //Indexes on result, linked to epoch when all codings are known
+	for _, leaf := range leaves {
+		t := leaf.Type
+		optional := t.Kind() == reflect.Pointer
+		if optional {
+			t = t.Elem()
+		}
+		if leaf.Coding != nil {
+			result = append(result, *leaf.Coding)
+			continue
+		}
+		if leaf.Block != nil {
+			coding, codingErr := blockLeafCoding(leaf)
+			if codingErr != nil {
+				return result, codingErr
+			}
+			if len(result) == 0 || result[len(result)-1].Block != leaf.Block { //Exponent before first element
+				exponent := coding
+				exponent.Name = BlockExponentName(leaf.Block.Name)
+				exponent.Meta = DirectiveMetadata{}
+				result = append(result, exponent)
+			}
+			result = append(result, coding)
+			continue
+		}
+		typename := codingTypename(t)
+		if leaf.Geo != "" {
+			coding, codingErr := geoCoding(leaf.Name, leaf.Geo, leaf.Tag, typename)
+			if codingErr != nil {
+				return result, codingErr
+			}
+			result = append(result, coding)
+			continue
+		}
+		if typename != "" {
+
+			var coding PiecewiseCoding
+			var codingErr error
+			if isStringerEnum(t, leaf.Tag) {
+				coding, codingErr = stringerCoding(leaf.Name, t, leaf.Tag)
+			} else {
+				coding, codingErr = createPiecewiseCodingFromStruct(leaf.Name, typename, leaf.Tag)
+			}
 			if codingErr != nil {
 				return result, codingErr
 			}
+			if optional {
+				coding, codingErr = optionalCoding(coding, typename, leaf.Tag)
+				if codingErr != nil {
+					return result, codingErr
+				}
+			}
+			if typename == typenameTime && hasDirective(leaf.Tag, DIRECTIVERELATIVE) {
+				relatives = append(relatives, len(result))
+			}
 			result = append(result, coding)
 
 		}
 	}
+	return result, linkRelatives(result, relatives)
+}
+
+// linkRelatives sets epoch field name to relative time fields. Only one epoch is allowed
+func linkRelatives(p PiecewiseFloats, relatives []int) error {
+	epochName := ""
+	for _, a := range p {
+		if a.Epoch {
+			if epochName != "" {
+				return fmt.Errorf("multiple epoch fields %v and %v", epochName, a.Name)
+			}
+			epochName = a.Name
+		}
+	}
+	if 0 < len(relatives) && epochName == "" {
+		return fmt.Errorf("%v is relative but epoch field is not defined", p[relatives[0]].Name)
+	}
+	for _, i := range relatives {
+		p[i].RelativeTo = epochName
+	}
+	return nil
+}
+
+// optionalCoding checks that pointer field have code for nil. Pointer to bool and time without clamped directive get NaN code, enums use empty code 0
+func optionalCoding(coding PiecewiseCoding, typename string, tag string) (PiecewiseCoding, error) {
+	if typename == "bool" || (typename == typenameTime && !hasDirective(tag, DIRECTIVECLAMPED)) {
+		coding.Clamped = false
+		return coding, nil
+	}
+	if coding.Omit || 0 < len(coding.Enums) {
+		return coding, nil
+	}
+	if coding.Clamped {
+		return coding, fmt.Errorf("%v is pointer but clamped, no NaN code for nil value", coding.Name)
+	}
+	return coding, nil
+}
+
+// Typenames of types detected explicitly. Other types are coded by reflect.Kind
+const (
+	typenameTime     = "Time"
+	typenameDuration = "Duration"
+	typenameFlags    = "[]string" //Slice of strings, only for flags
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// codingTypename picks coding by kind so named types like `type Celsius float64` work. Empty if type is not supported
+func codingTypename(t reflect.Type) string {
+	switch t {
+	case timeType:
+		return typenameTime
+	case durationType:
+		return typenameDuration
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return t.Kind().String()
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.String {
+			return typenameFlags
+		}
+	}
+	return ""
+}
+
+// structLeaf is one value of flattened struct
+type structLeaf struct {
+	Name string       //Dotted name, array elements are indexed like Ch[3]
+	Path []fieldStep  //How to get value from struct
+	Type reflect.Type //Type of value
+	Tag  string       //splurts directives of field. Array elements share same
+
+	Coding *PiecewiseCoding //From SplurtsMarshaler sub schema, already renamed
+	Sub    int              //Index of value on SplurtsMarshaler
+
+	Geo string //GEOLAT or GEOLON when value is part of geo position, Tag is tag of position field
+
+	Block *BlockCoding //Block floating point element, shared by elements of same field
+}
+
+// fieldStep is one step from struct to value, struct field or array element
+type fieldStep struct {
+	Index   int
+	Element bool //Index is array index, not field index
+}
+
+// isNestedStruct tells is field flattened. time.Time and SplurtsMarshaler types are values, not nested structs
+func isNestedStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != timeType && !isMarshaler(t)
+}
+
+// hasDirective checks single keyword directive like omit without parsing whole tag
+func hasDirective(tag string, directive string) bool {
+	for _, tok := range strings.Split(tag, ",") {
+		if tok == directive {
+			return true
+		}
+	}
+	return false
+}
+
+// flattenStruct lists all values of struct type in declaration order. Nested structs and arrays are expanded
+func flattenStruct(t reflect.Type) ([]structLeaf, error) {
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("struct required, got %v", t)
+	}
+	result := []structLeaf{}
+	errAppend := appendStructLeaves(&result, t, "", nil)
+	if errAppend != nil {
+		return nil, errAppend
+	}
+	names := make(map[string]bool)
+	for _, leaf := range result {
+		if names[leaf.Name] {
+			return nil, fmt.Errorf("duplicate field name %v on flattened struct %v", leaf.Name, t)
+		}
+		names[leaf.Name] = true
+	}
 	return result, nil
 }
 
-// setValuesFromFloatMap is helper function
-func (p *PiecewiseFloats) setValuesFromFloatMap(v interface{}, values map[string]float64) error {
-	elem := reflect.ValueOf(v).Elem()
-	for name, inputValue := range values {
-		f := elem.FieldByName(name)
-		if f.IsValid() {
-			switch f.Type().Name() {
-			case "float64", "float32":
-				f.SetFloat(inputValue)
-			case "int", "int8", "int16", "int32", "int64":
-				f.SetInt(int64(inputValue))
-			case "uint", "uint8", "uint16", "uint32", "uint64":
-				f.SetUint(uint64(inputValue))
-			case "bool":
-				f.SetBool(0 < inputValue)
-			case "string":
-				pw, foundErr := p.getCoding(name)
-				if foundErr != nil {
-					return foundErr
-				}
-				index := int(inputValue)
-				if index == 0 {
-					f.SetString("") //First0 is empty/missign
-				} else {
-					if 0 <= index && index <= len(pw.Enums) {
-						f.SetString(pw.Enums[index-1])
-					}
-				}
-			case "Time":
-				timeParsed := time.UnixMilli(int64(inputValue))
-				f.Set(reflect.ValueOf(timeParsed))
+func appendStep(path []fieldStep, step fieldStep) []fieldStep {
+	return append(append([]fieldStep{}, path...), step)
+}
 
-			default:
-				return fmt.Errorf("unknown type %v", f.Type().Name())
+func appendStructLeaves(result *[]structLeaf, t reflect.Type, prefix string, path []fieldStep) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get(SPLURTS)
+		if (isNestedStruct(field.Type) || isMarshaler(field.Type)) && hasDirective(tag, DIRECTIVEOMIT) {
+			continue
+		}
+		name := prefix + field.Name
+		if field.Anonymous && isNestedStruct(field.Type) {
+			name = strings.TrimSuffix(prefix, ".")
+		}
+		errAppend := appendValueLeaves(result, field.Type, name, appendStep(path, fieldStep{Index: i}), tag)
+		if errAppend != nil {
+			return errAppend
+		}
+	}
+	return nil
+}
+
+// appendValueLeaves expands nested structs, arrays and SplurtsMarshaler sub schemas or adds value as leaf
+func appendValueLeaves(result *[]structLeaf, t reflect.Type, name string, path []fieldStep, tag string) error {
+	if isMarshaler(t) {
+		return appendMarshalerLeaves(result, t, name, path)
+	}
+	if IsGeoField(t, tag) {
+		return appendGeoLeaves(result, t, name, path, tag)
+	}
+	if IsBlockField(t, tag) {
+		return appendBlockLeaves(result, t, name, path, tag)
+	}
+	if isNestedStruct(t) {
+		prefix := name + "."
+		if name == "" {
+			prefix = ""
+		}
+		return appendStructLeaves(result, t, prefix, path)
+	}
+	if t.Kind() == reflect.Array {
+		for j := 0; j < t.Len(); j++ {
+			errAppend := appendValueLeaves(result, t.Elem(), fmt.Sprintf("%s[%v]", name, j), appendStep(path, fieldStep{Index: j, Element: true}), tag)
+			if errAppend != nil {
+				return errAppend
 			}
 		}
+		return nil
 	}
+	*result = append(*result, structLeaf{Name: name, Path: path, Type: t, Tag: tag})
 	return nil
 }
 
@@ -428,75 +958,16 @@ func (p *PiecewiseFloats) GetValuesToFloatMapArr(v interface{}) (map[string][]fl
 func (p *PiecewiseFloats) GetValuesToFloatMap(v interface{}) (map[string]float64, error) {
 	result := make(map[string]float64)
 	elem := reflect.ValueOf(v)
-	typeOfS := elem.Type()
-
-	for i := 0; i < elem.NumField(); i++ {
-		f := elem.Field(i)
-
-		if f.IsValid() {
-
-			name := typeOfS.Field(i).Name
-
-			pw, foundErr := p.getCoding(name)
-			if foundErr != nil {
-				return result, foundErr
-			}
-
-			if pw.Omit {
-				continue
-			}
-
-			switch f.Type().Name() {
-			case "float64", "float32":
-				result[name] = f.Float()
-			case "int", "int8", "int16", "int32", "int64":
-				result[name] = float64(f.Int())
-			case "uint", "uint8", "uint16", "uint32", "uint64":
-				result[name] = float64(f.Uint())
-			case "bool":
-				result[name] = 0
-				if f.Bool() {
-					result[name] = 1
-				}
-			case "string":
-				stringvalue := f.String()
-
-				if stringvalue == "" {
-					result[name] = 0
-				} else {
-					found := false
-					for indexresult, enumstring := range pw.Enums {
-						if enumstring == stringvalue {
-							result[name] = float64(indexresult + 1)
-							found = true
-							continue
-						}
-					}
-					if !found {
-						return result, fmt.Errorf("unknown enum %s for %s (valid enums are %#v)", stringvalue, name, pw.Enums)
-					}
-				}
-			case "Time":
-				timevalue := f.Interface().(time.Time)
-				//timevalue := reflect.ValueOf(f).Interface().(time.Time)
-				result[name] = float64(timevalue.UnixMilli()) //Lets use milliseconds for compatibility and overflow reasons with javascript
-			default:
-				return result, fmt.Errorf("unknown type %s at %v", f.Type().Name(), f)
-			}
-
-			f := result[name]
-			if pw.InfPosDefined && math.IsInf(f, 1) {
-				result[name] = pw.InfPos
-			}
-			if pw.InfNegDefined && math.IsInf(f, -1) {
-				result[name] = pw.InfNeg
-			}
-			if pw.ConstDefined {
-				result[name] = pw.Const
-			}
-		}
+	plan, errPlan := getStructPlan(elem.Type())
+	if errPlan != nil {
+		return result, errPlan
 	}
-	return result, nil
+	errValues := plan.encodeValues(*p, elem, func(pw *PiecewiseCoding, f float64, haz bool) {
+		if haz {
+			result[pw.Name] = f
+		}
+	})
+	return result, errValues
 }
 
 // UnSplurts converts byte array to wanted target struct  (remember &output when call)
@@ -505,36 +976,80 @@ func (p *PiecewiseFloats) UnSplurts(raw []byte, output interface{}) error {
 	if errInv != nil {
 		return errInv
 	}
-	variableMap, errDecode := p.Decode(raw, true)
+	values := make([]float64, len(*p))
+	errDecode := p.DecodeInto(raw, values) //Only pass over bits, checks whole record before output is set
 	if errDecode != nil {
 		return errDecode
 	}
-	return p.setValuesFromFloatMap(output, variableMap)
+	return p.setFieldsFromValues(output, values)
+}
+
+// setFieldsFromValues sets fields of output (pointer to struct) from all non omitted values indexed same way as PiecewiseFloats
+func (p *PiecewiseFloats) setFieldsFromValues(output interface{}, values []float64) error {
+	return p.setFields(output, func(fn func(i int, a *PiecewiseCoding, v float64) error) error {
+		for i := range *p {
+			if (*p)[i].Omit {
+				continue
+			}
+			errFn := fn(i, &(*p)[i], values[i])
+			if errFn != nil {
+				return errFn
+			}
+		}
+		return nil
+	})
 }
 
 func (p *PiecewiseFloats) UnSplurts7bitBytes(raw SevenBitArr, output interface{}) error {
-	errInv := p.IsInvalid()
-	if errInv != nil {
-		return errInv
-	}
-	variableMap, errDecode := p.Decode7bitBytes(raw, true)
+	binarr, errDecode := p.sevenBitToBytes(raw)
 	if errDecode != nil {
 		return errDecode
 	}
-	return p.setValuesFromFloatMap(output, variableMap)
+	return p.UnSplurts(binarr, output)
 }
 
 // Splurts data to bytes  Get piecewiseFloatStruct by calling GetPiecewisesFromStruct
 func (p *PiecewiseFloats) Splurts(input interface{}) ([]byte, error) {
-	m, e := p.GetValuesToFloatMap(input)
-	if e != nil {
-		return []byte{}, e
+	return p.AppendSplurts(make([]byte, 0, p.NumberOfBytes()), input)
+}
+
+// AppendSplurts appends splurtsed input to dst and returns extended slice. Like Splurts but without intermediate map.
+// Does not allocate when dst have enough capacity and input is pointer to struct
+func (p *PiecewiseFloats) AppendSplurts(dst []byte, input interface{}) ([]byte, error) {
+	elem := reflect.Indirect(reflect.ValueOf(input))
+	if elem.Kind() != reflect.Struct {
+		return dst, fmt.Errorf("struct or pointer to struct required, got %v", elem.Kind())
 	}
-	result, errEncode := p.Encode(m)
-	if errEncode != nil {
-		return result, fmt.Errorf("encoding error %v", errEncode.Error())
+	plan, errPlan := getStructPlan(elem.Type())
+	if errPlan != nil {
+		return dst, errPlan
 	}
-	return result, nil
+	w := BitWriter{buf: dst, start: len(dst)}
+	exponent := math.NaN() //Of latest block
+	var errCircular error
+	errValues := plan.encodeValues(*p, elem, func(pw *PiecewiseCoding, f float64, haz bool) {
+		if pw.Omit {
+			return
+		}
+		if !haz {
+			f = math.NaN()
+		}
+		if errCircular == nil {
+			errCircular = pw.circularValueIsInvalid(f)
+		}
+		if haz {
+			w.WriteBits(pw.codeOf(f, &exponent), pw.NumberOfBits())
+		} else {
+			w.WriteBits(pw.missingCode(), pw.NumberOfBits())
+		}
+	})
+	if errValues != nil {
+		return dst, errValues
+	}
+	if errCircular != nil {
+		return dst, errCircular
+	}
+	return w.buf, nil
 }
 
 func (p *PiecewiseFloats) SplurtsHex(input interface{}) (string, error) {
@@ -561,7 +1076,7 @@ func (p *PiecewiseFloats) Splurts7bitBytes(input interface{}) (SevenBitArr, erro
 	return p.Encode7bitBytes(m)
 }
 
-// ToStrings writes values with required number of decimals and enums in string format
+// ToStrings writes values with required number of decimals and enums in string format. Positions are also as lat/lon pairs named like position field
 func (p *PiecewiseFloats) ToStrings(input interface{}, quotes bool) (map[string]string, error) {
 	result := make(map[string]string)
 	m, e := p.GetValuesToFloatMap(input)
@@ -578,12 +1093,15 @@ func (p *PiecewiseFloats) ToStrings(input interface{}, quotes bool) (map[string]
 		if svalErr != nil {
 			return nil, fmt.Errorf("variable %v with value %v conversion to string fail err=%v", pw.Name, v, svalErr.Error())
 		}
-		if 0 < len(pw.Enums) && quotes {
+		if (0 < len(pw.Enums) || 0 < len(pw.Flags) || 0 < pw.TextLength) && quotes {
 			result[pw.Name] = "\"" + sval + "\""
 		} else {
 			result[pw.Name] = sval
 		}
 	}
+	for _, pair := range p.GeoPairs() { //Positions as lat/lon pairs
+		result[pair.Name] = GeoPairString(result[pair.Lat], result[pair.Lon])
+	}
 	return result, nil
 }
 
@@ -599,7 +1117,7 @@ func (p *PiecewiseFloats) ToCsv(input interface{}, separator string, columns []s
 	rt := reflect.TypeOf(input)
 
 	if len(columns) == 0 {
-		columns = p.Names()
+		columns = p.ExportNames()
 	}
 	switch rt.Kind() {
 	case reflect.Slice, reflect.Array:
@@ -617,3 +617,410 @@ func TestCsv(t *testing.T) {
 
 	assert.Equal(t, "-40.1\t110.13\n-40.1\t110.13\n3.0\t110.13\n5.0\t110.13\n5.0\t110.13\n", txtTempHum)
 }
+
+func TestAppendSplurts(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(AllCases{})
+	assert.Equal(t, nil, errRecipe)
+	d := AllCases{Alpha: 2.3, Bravo: 10.1, Charlie: 42, Delta: 123, Echo: true, Foxtrot: 13.5, Golf: 5, Hotel: 26.4, Mike: -21.5, Oscar: 42.69}
+
+	ref, errSplurt := recipe.Splurts(d)
+	assert.Equal(t, nil, errSplurt)
+
+	ring := make([]byte, 0, 10*recipe.NumberOfBytes())
+	ring, errAppend := recipe.AppendSplurts(ring, &d)
+	assert.Equal(t, nil, errAppend)
+	ring, errAppend = recipe.AppendSplurts(ring, d)
+	assert.Equal(t, nil, errAppend)
+	assert.Equal(t, append(append([]byte{}, ref...), ref...), ring)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		ring, _ = recipe.AppendSplurts(ring[:0], &d)
+	})
+	assert.Equal(t, float64(0), allocs)
+
+	_, errAppend = recipe.AppendSplurts(nil, []AllCases{d})
+	assert.NotEqual(t, nil, errAppend)
+
+	timeRecipe, _ := GetPiecewisesFromStruct(TimeExampleStruct{})
+	td := TimeExampleStruct{CompleteTime: time.UnixMilli(1670523401643), SecondTime: time.UnixMilli(1670523401643)}
+	timeRef, _ := timeRecipe.Splurts(td)
+	timeBuf := make([]byte, 0, 64)
+	allocs = testing.AllocsPerRun(100, func() {
+		timeBuf, _ = timeRecipe.AppendSplurts(timeBuf[:0], &td)
+	})
+	assert.Equal(t, float64(0), allocs)
+	assert.Equal(t, timeRef, timeBuf)
+}
+
+type EnvMeas struct {
+	Temp float64 `splurts:"step=0.1,min=-40,max=40"`
+	Hum  float64 `splurts:"step=0.5,min=0,max=100"`
+}
+
+type DeviceInfo struct {
+	Status string `splurts:"enum=IDLE,RUN"`
+}
+
+type NestedMeas struct {
+	DeviceInfo //embedded, fields are promoted
+	Indoor     EnvMeas
+	Outdoor    EnvMeas
+	Stamp      time.Time `splurts:"min=1670000000000,step=1000"`
+	Debug      EnvMeas   `splurts:"omit"`
+}
+
+func TestNestedStruct(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(NestedMeas{})
+	assert.Equal(t, nil, errRecipe)
+	assert.Equal(t, []string{"Status", "Indoor.Temp", "Indoor.Hum", "Outdoor.Temp", "Outdoor.Hum", "Stamp"}, recipe.Names())
+	assert.Equal(t, 2+10+8+10+8+32, recipe.NumberOfBits())
+
+	d := NestedMeas{
+		DeviceInfo: DeviceInfo{Status: "RUN"},
+		Indoor:     EnvMeas{Temp: 21.5, Hum: 40},
+		Outdoor:    EnvMeas{Temp: -5.2, Hum: 80.5},
+		Stamp:      time.UnixMilli(1670523401000),
+		Debug:      EnvMeas{Temp: 1, Hum: 2},
+	}
+	byt, errSplurt := recipe.Splurts(d)
+	assert.Equal(t, nil, errSplurt)
+
+	back := NestedMeas{}
+	assert.Equal(t, nil, recipe.UnSplurts(byt, &back))
+	assert.Equal(t, "RUN", back.Status)
+	assert.InDelta(t, d.Indoor.Temp, back.Indoor.Temp, 0.0001)
+	assert.InDelta(t, d.Outdoor.Temp, back.Outdoor.Temp, 0.0001)
+	assert.InDelta(t, d.Outdoor.Hum, back.Outdoor.Hum, 0.0001)
+	assert.Equal(t, d.Stamp, back.Stamp)
+	assert.Equal(t, EnvMeas{}, back.Debug)
+
+	strs, errStrings := recipe.ToStrings(d, false)
+	assert.Equal(t, nil, errStrings)
+	assert.Equal(t, "-5.2", strs["Outdoor.Temp"])
+
+	csv, errCsv := recipe.ToCsv([]NestedMeas{d, d}, ";", []string{"Status", "Indoor.Temp", "Outdoor.Hum"}, false)
+	assert.Equal(t, nil, errCsv)
+	assert.Equal(t, "RUN;21.5;80.5\nRUN;21.5;80.5\n", csv)
+
+	m, errMap := recipe.GetValuesToFloatMapArr([]NestedMeas{d})
+	assert.Equal(t, nil, errMap)
+	assert.Equal(t, []float64{40}, m["Indoor.Hum"])
+}
+
+type DuplicateNested struct {
+	DeviceInfo
+	Status string `splurts:"enum=A,B"`
+}
+
+func TestNestedStructFails(t *testing.T) {
+	_, e := GetPiecewisesFromStruct(DuplicateNested{})
+	assert.NotEqual(t, nil, e)
+}
+
+type AdcSample struct {
+	Ch      [8]float64 `splurts:"min=0,max=2.5,bits=12,clamped"`
+	Sensors [2]EnvMeas
+	Flags   [3]bool
+}
+
+func TestArrayFields(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(AdcSample{})
+	assert.Equal(t, nil, errRecipe)
+	names := recipe.Names()
+	assert.Equal(t, 8+4+3, len(names))
+	assert.Equal(t, "Ch[3]", names[3])
+	assert.Equal(t, "Sensors[1].Hum", names[11])
+	assert.Equal(t, "Flags[2]", names[14])
+	assert.Equal(t, 8*12+2*(10+8)+3, recipe.NumberOfBits())
+
+	d := AdcSample{
+		Ch:      [8]float64{0, 0.5, 1, 1.25, 1.5, 2, 2.25, 2.5},
+		Sensors: [2]EnvMeas{{Temp: 20.1, Hum: 30}, {Temp: -3, Hum: 99.5}},
+		Flags:   [3]bool{true, false, true},
+	}
+	byt, errSplurt := recipe.Splurts(d)
+	assert.Equal(t, nil, errSplurt)
+	back := AdcSample{}
+	assert.Equal(t, nil, recipe.UnSplurts(byt, &back))
+	for i := range d.Ch {
+		assert.InDelta(t, d.Ch[i], back.Ch[i], 0.001)
+	}
+	assert.InDelta(t, d.Sensors[1].Temp, back.Sensors[1].Temp, 0.0001)
+	assert.Equal(t, d.Flags, back.Flags)
+
+	csv, errCsv := recipe.ToCsv([]AdcSample{d}, ";", []string{"Ch[1]", "Ch[7]", "Sensors[0].Temp", "Flags[0]"}, false)
+	assert.Equal(t, nil, errCsv)
+	assert.Equal(t, "0.5000;2.5000;20.1;1\n", csv)
+}
+
+type OptionalMeas struct {
+	Temperature *float64 `splurts:"step=0.1,min=-40,max=40"`
+	Count       *int32   `splurts:"step=1,min=0,max=1000"`
+	Heater      *bool
+	Status      *string `splurts:"enum=IDLE,RUN"`
+	Humidity    float64 `splurts:"step=0.5,min=0,max=100"`
+}
+
+type OptionalClamped struct {
+	Level *int `splurts:"min=0,max=15,clamped"`
+}
+
+type OptionalTimes struct {
+	Start *time.Time `splurts:"epoch"`
+	Stop  *time.Time `splurts:"relative,step=1s,max=1h"`
+}
+
+type OptionalTimeClamped struct {
+	Start *time.Time `splurts:"clamped"`
+}
+
+func TestOptionalFields(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(OptionalMeas{})
+	assert.Equal(t, nil, errRecipe)
+	assert.Equal(t, false, recipe[2].Clamped, "pointer to bool needs NaN code")
+
+	temp := 21.5
+	count := int32(42)
+	heater := true
+	status := "RUN"
+	full := OptionalMeas{Temperature: &temp, Count: &count, Heater: &heater, Status: &status, Humidity: 30}
+	byt, errSplurt := recipe.Splurts(full)
+	assert.Equal(t, nil, errSplurt)
+	back := OptionalMeas{}
+	assert.Equal(t, nil, recipe.UnSplurts(byt, &back))
+	assert.Equal(t, temp, *back.Temperature)
+	assert.Equal(t, count, *back.Count)
+	assert.Equal(t, heater, *back.Heater)
+	assert.Equal(t, status, *back.Status)
+
+	missing := OptionalMeas{Humidity: 30}
+	byt, errSplurt = recipe.Splurts(&missing)
+	assert.Equal(t, nil, errSplurt)
+	back = full //nil must overwrite existing pointers
+	assert.Equal(t, nil, recipe.UnSplurts(byt, &back))
+	assert.Equal(t, missing, back)
+
+	m, _ := recipe.GetValuesToFloatMap(missing)
+	assert.True(t, math.IsNaN(m["Temperature"]))
+	assert.True(t, math.IsNaN(m["Heater"]))
+	assert.Equal(t, float64(0), m["Status"])
+
+	codec, errCodec := NewCodec[OptionalMeas]()
+	assert.Equal(t, nil, errCodec)
+	again, _ := codec.Marshal(missing)
+	assert.Equal(t, byt, again)
+	typedBack, _ := codec.Unmarshal(again)
+	assert.Equal(t, missing, typedBack)
+
+	_, errRecipe = GetPiecewisesFromStruct(OptionalClamped{})
+	assert.NotEqual(t, nil, errRecipe)
+	clamped := PiecewiseFloats{{Name: "Level", Min: 0, Clamped: true, Steps: []PiecewiseCodingStep{{Size: 1, Count: 16}}}}
+	_, errSplurt = clamped.Splurts(OptionalClamped{})
+	assert.NotEqual(t, nil, errSplurt)
+}
+
+func TestOptionalTimes(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(OptionalTimes{})
+	assert.Equal(t, nil, errRecipe)
+	assert.False(t, recipe[0].Clamped, "nil time needs NaN code")
+	assert.False(t, recipe[1].Clamped)
+
+	start := time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+	stop := start.Add(90 * time.Second)
+	full := OptionalTimes{Start: &start, Stop: &stop}
+	byt, errSplurt := recipe.Splurts(full)
+	assert.Equal(t, nil, errSplurt)
+	back := OptionalTimes{}
+	assert.Equal(t, nil, recipe.UnSplurts(byt, &back))
+	assert.True(t, start.Equal(*back.Start))
+	assert.True(t, stop.Equal(*back.Stop))
+
+	byt, errSplurt = recipe.Splurts(OptionalTimes{})
+	assert.Equal(t, nil, errSplurt)
+	back = full
+	assert.Equal(t, nil, recipe.UnSplurts(byt, &back))
+	assert.Equal(t, OptionalTimes{}, back)
+	codec, errCodec := NewCodec[OptionalTimes]()
+	assert.Equal(t, nil, errCodec)
+	again, _ := codec.Marshal(OptionalTimes{})
+	assert.Equal(t, byt, again)
+
+	_, errRecipe = GetPiecewisesFromStruct(OptionalTimeClamped{})
+	assert.NotEqual(t, nil, errRecipe, "clamped directive is explicit")
+}
+
+type Celsius float64
+type State string
+type Level uint8
+
+// Time is not time.Time, must not be coded as timestamp
+type Time int32
+
+type DomainMeas struct {
+	Temperature Celsius       `splurts:"step=0.1,min=-40,max=40"`
+	Status      State         `splurts:"enum=IDLE,RUN"`
+	Fill        Level         `splurts:"min=0,max=15,clamped,const=7"`
+	Uptime      Time          `splurts:"min=0,max=1000"`
+	Interval    time.Duration `splurts:"step=1ms,max=1m"`
+	Target      *Celsius      `splurts:"step=0.1,min=-40,max=40"`
+}
+
+func TestNamedTypes(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(DomainMeas{})
+	assert.Equal(t, nil, errRecipe)
+	assert.Equal(t, 6, len(recipe))
+	assert.Equal(t, []string{"IDLE", "RUN"}, recipe[1].Enums)
+	assert.Equal(t, float64(7), recipe[2].Const)
+	assert.Equal(t, false, recipe[3].Clamped)
+
+	target := Celsius(-3.5)
+	d := DomainMeas{Temperature: 21.5, Status: "RUN", Uptime: 999, Interval: 1500 * time.Millisecond, Target: &target}
+	byt, errSplurt := recipe.Splurts(d)
+	assert.Equal(t, nil, errSplurt)
+	back := DomainMeas{}
+	assert.Equal(t, nil, recipe.UnSplurts(byt, &back))
+	d.Fill = 7
+	assert.Equal(t, d, back)
+
+	_, errSplurt = recipe.Splurts(DomainMeas{Status: "STOP"})
+	assert.NotEqual(t, nil, errSplurt)
+}
+
+type UptimeMeas struct {
+	Uptime  time.Duration `splurts:"step=1s,min=0,max=240h"`
+	Latency time.Duration `splurts:"step=10ms,max=1h,infpos=3600"`
+	Dwell   time.Duration `splurts:"steps=100ms 50|1s 55,const=0.5s"`
+}
+
+func TestDurationFields(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(UptimeMeas{})
+	assert.Equal(t, nil, errRecipe)
+	assert.Equal(t, float64(1), recipe[0].Steps[0].Size)
+	assert.Equal(t, uint64(240*3600), recipe[0].Steps[0].Count)
+	assert.Equal(t, "s", recipe[1].Meta.Unit)
+	assert.Equal(t, 2, recipe[1].Decimals())
+	assert.Equal(t, 0.5, recipe[2].Const)
+
+	d := UptimeMeas{Uptime: 50*time.Hour + 3*time.Second, Latency: 1230 * time.Millisecond}
+	byt, errSplurt := recipe.Splurts(d)
+	assert.Equal(t, nil, errSplurt)
+	back := UptimeMeas{}
+	assert.Equal(t, nil, recipe.UnSplurts(byt, &back))
+	d.Dwell = 500 * time.Millisecond
+	assert.Equal(t, d, back)
+
+	strs, errStrings := recipe.ToStrings(d, false)
+	assert.Equal(t, nil, errStrings)
+	assert.Equal(t, "180003", strs["Uptime"])
+	assert.Equal(t, "1.23", strs["Latency"])
+
+	csv, errCsv := recipe.ToCsv([]UptimeMeas{d, back}, ";", []string{"Latency", "Dwell"}, false)
+	assert.Equal(t, nil, errCsv)
+	assert.Equal(t, "1.23;0.5\n1.23;0.5\n", csv)
+
+	_, errRecipe = GetPiecewisesFromStruct(struct {
+		D time.Duration `splurts:"step=10 apples"`
+	}{})
+	assert.NotEqual(t, nil, errRecipe)
+}
+
+type SessionHeader struct {
+	Start time.Time `splurts:"epoch,step=1000"`
+}
+
+type SessionSample struct {
+	Start       time.Time `splurts:"epoch,omit"` //Sent once on SessionHeader
+	Measured    time.Time `splurts:"relative,step=100,max=1h"`
+	Temperature float64   `splurts:"step=0.1,min=-40,max=40"`
+}
+
+func TestRelativeTime(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(SessionSample{})
+	assert.Equal(t, nil, errRecipe)
+	assert.Equal(t, "Start", recipe[1].RelativeTo)
+	assert.Equal(t, true, recipe[0].Epoch)
+	assert.Equal(t, 16+10, recipe.NumberOfBits())
+
+	start := time.UnixMilli(1670523401000)
+	d := SessionSample{Start: start, Measured: start.Add(12*time.Minute + 300*time.Millisecond), Temperature: 21.5}
+	byt, errSplurt := recipe.Splurts(d)
+	assert.Equal(t, nil, errSplurt)
+	assert.Equal(t, 4, len(byt))
+
+	back := SessionSample{Start: start} //Epoch from header
+	assert.Equal(t, nil, recipe.UnSplurts(byt, &back))
+	assert.Equal(t, d, back)
+
+	codec, errCodec := NewCodec[SessionSample]()
+	assert.Equal(t, nil, errCodec)
+	again, _ := codec.Marshal(d)
+	assert.Equal(t, byt, again)
+	typedBack := SessionSample{Start: start}
+	assert.Equal(t, nil, codec.UnmarshalInto(byt, &typedBack))
+	assert.Equal(t, d, typedBack)
+
+	m, _ := recipe.GetValuesToFloatMap(d)
+	assert.Equal(t, float64(12*60*1000+300), m["Measured"])
+
+	_, errRecipe = GetPiecewisesFromStruct(struct {
+		Measured time.Time `splurts:"relative"`
+	}{})
+	assert.NotEqual(t, nil, errRecipe, "epoch missing")
+	_, errRecipe = GetPiecewisesFromStruct(struct {
+		A time.Time `splurts:"epoch"`
+		B time.Time `splurts:"epoch"`
+	}{})
+	assert.NotEqual(t, nil, errRecipe, "multiple epochs")
+	_, errRecipe = GetPiecewisesFromStruct(struct {
+		A float64 `splurts:"epoch,step=1,max=10"`
+	}{})
+	assert.NotEqual(t, nil, errRecipe, "epoch must be time")
+}
+
+type RelativeFirst struct {
+	Measured time.Time `splurts:"relative,step=1s"`
+	Start    time.Time `splurts:"epoch,step=1000"`
+}
+
+func TestRelativeBeforeEpoch(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(RelativeFirst{})
+	assert.Equal(t, nil, errRecipe)
+	assert.Equal(t, float64(1000), recipe[0].Steps[0].Size)
+	d := RelativeFirst{Start: time.UnixMilli(1670523401000), Measured: time.UnixMilli(1670523461000)}
+	byt, _ := recipe.Splurts(d)
+	back := RelativeFirst{}
+	assert.Equal(t, nil, recipe.UnSplurts(byt, &back))
+	assert.Equal(t, d, back)
+
+	codec, _ := NewStructCodec(RelativeFirst{})
+	codecBack := RelativeFirst{}
+	assert.Equal(t, nil, codec.UnSplurts(byt, &codecBack))
+	assert.Equal(t, d, codecBack)
+}
+
+type RadiationMeas struct {
+	Dose      float64 `splurts:"log,min=0.01,max=10000,relstep=1%"`
+	Particles float64 `splurts:"log,min=1,max=1000000,bits=10,clamped"`
+}
+
+func TestLogDirective(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(RadiationMeas{})
+	assert.Equal(t, nil, errRecipe)
+	assert.Equal(t, true, recipe[0].Log)
+	assert.Equal(t, []PiecewiseCodingStep{{Size: 0.01, Count: 1389}}, recipe[0].Steps)
+	assert.Equal(t, 10, recipe[1].NumberOfBits())
+	assert.InDelta(t, 1000000, recipe[1].Max(), 0.001)
+
+	d := RadiationMeas{Dose: 0.42, Particles: 123456}
+	byt, errSplurt := recipe.Splurts(d)
+	assert.Equal(t, nil, errSplurt)
+	back := RadiationMeas{}
+	assert.Equal(t, nil, recipe.UnSplurts(byt, &back))
+	assert.InEpsilon(t, d.Dose, back.Dose, 0.005)
+	assert.InEpsilon(t, d.Particles, back.Particles, 0.01)
+
+	for _, tag := range []string{"log,min=0,max=10,relstep=1%", "log,min=1,max=10", "log,min=1,relstep=1%", "log,min=1,max=10,relstep=-1%"} {
+		_, errCoding := createPiecewiseCodingFromStruct("A", "float64", tag)
+		assert.NotEqual(t, nil, errCoding, tag)
+	}
+}
@@ -0,0 +1,271 @@
+/*
+Enum codes. By default enums get codes by position starting from 1 and code 0 is empty string.
+Explicit codes like IDLE:1,RUN:5 keep payloads compatible when enums are reordered or added.
+On integer fields code is value of field, positional codes start from 0 like iota. Integer types with String() are enums without directive
+*/
+
+package splurts
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const MAXSTRINGERCODE = 255 //Highest value probed from String() of integer enum type
+
+// parseEnums parses enum names with optional codes like IDLE:1,RUN:5,ERROR. Name without code gets previous code + 1.
+// Integer enums start from 0 and always have codes
+func parseEnums(tokens []string, integer bool) ([]string, []uint64, error) {
+	names := make([]string, len(tokens))
+	codes := make([]uint64, len(tokens))
+	explicit := integer
+	next := uint64(1) //Code 0 is empty string
+	if integer {
+		next = 0
+	}
+	for i, tok := range tokens {
+		nameCode := strings.Split(tok, ":")
+		if 2 < len(nameCode) {
+			return nil, nil, fmt.Errorf("invalid enum %v, only name:code", tok)
+		}
+		code := next
+		if len(nameCode) == 2 {
+			var errCode error
+			code, errCode = strconv.ParseUint(nameCode[1], 0, 64)
+			if errCode != nil {
+				return nil, nil, fmt.Errorf("invalid enum code %v", tok)
+			}
+			explicit = true
+		}
+		names[i] = nameCode[0]
+		codes[i] = code
+		next = code + 1
+	}
+	if !explicit {
+		return names, nil, nil //Positional, like before explicit codes
+	}
+	return names, codes, nil
+}
+
+// enumCodeOf code of enum index i
+func (p *PiecewiseCoding) enumCodeOf(i int) uint64 {
+	if len(p.EnumCodes) == 0 {
+		return uint64(i) + 1
+	}
+	return p.EnumCodes[i]
+}
+
+// maxEnumCode highest enum code
+func (p *PiecewiseCoding) maxEnumCode() uint64 {
+	result := uint64(0)
+	for i := range p.Enums {
+		if result < p.enumCodeOf(i) {
+			result = p.enumCodeOf(i)
+		}
+	}
+	return result
+}
+
+// EnumCode code of enum name. Empty string is 0 if no enum have code 0. Unknown name gets code of EnumUnknown if defined
+func (p *PiecewiseCoding) EnumCode(name string) (uint64, error) {
+	for i, enumstring := range p.Enums {
+		if enumstring == name {
+			return p.enumCodeOf(i), nil
+		}
+	}
+	if name == "" && !p.enumHasCode(0) {
+		return 0, nil
+	}
+	if p.EnumUnknown != "" && p.EnumUnknown != name {
+		return p.EnumCode(p.EnumUnknown)
+	}
+	return 0, fmt.Errorf("unknown enum %s for %s (valid enums are %#v)", name, p.Name, p.Enums)
+}
+
+// EnumName name of enum code. Code 0 is empty string if no enum have code 0. Unknown code gets EnumUnknown if defined
+func (p *PiecewiseCoding) EnumName(code uint64) (string, error) {
+	for i, enumstring := range p.Enums {
+		if p.enumCodeOf(i) == code {
+			return enumstring, nil
+		}
+	}
+	if code == 0 {
+		return "", nil
+	}
+	if p.EnumUnknown != "" {
+		return p.EnumUnknown, nil
+	}
+	return "", fmt.Errorf("variable %s have value %v, but it is not valid enum code", p.Name, code)
+}
+
+func (p *PiecewiseCoding) enumHasCode(code uint64) bool {
+	for i := range p.Enums {
+		if p.enumCodeOf(i) == code {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeEnum gives enum code, unknown code is replaced with code of EnumUnknown
+func (p *PiecewiseCoding) decodeEnum(code uint64) (uint64, error) {
+	name, errName := p.EnumName(code)
+	if errName != nil {
+		return code, errName
+	}
+	return p.EnumCode(name)
+}
+
+func (p *PiecewiseCoding) enumsIsInvalid() error {
+	if len(p.EnumCodes) != 0 && len(p.EnumCodes) != len(p.Enums) {
+		return fmt.Errorf("%v have %v enums but %v enum codes", p.Name, len(p.Enums), len(p.EnumCodes))
+	}
+	for i, name := range p.Enums {
+		for j := 0; j < i; j++ {
+			if p.Enums[j] == name {
+				return fmt.Errorf("%v enum %v is defined twice", p.Name, name)
+			}
+			if p.enumCodeOf(j) == p.enumCodeOf(i) {
+				return fmt.Errorf("%v enums %v and %v have same code %v", p.Name, p.Enums[j], name, p.enumCodeOf(i))
+			}
+		}
+	}
+	if p.EnumUnknown != "" && !p.enumHasName(p.EnumUnknown) {
+		return fmt.Errorf("%v unknown enum %v is not in enums %#v", p.Name, p.EnumUnknown, p.Enums)
+	}
+	return nil
+}
+
+func (p *PiecewiseCoding) enumHasName(name string) bool {
+	for _, enumstring := range p.Enums {
+		if enumstring == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isIntegerTypename(typename string) bool {
+	switch typename {
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+		return true
+	}
+	return false
+}
+
+var stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+
+// isStringerEnum integer type with String() is enum if tag does not define other coding
+func isStringerEnum(t reflect.Type, tag string) bool {
+	if !isIntegerTypename(codingTypename(t)) {
+		return false
+	}
+	if !t.Implements(stringerType) && !reflect.PointerTo(t).Implements(stringerType) {
+		return false
+	}
+	for _, tok := range strings.Split(tag, ",") {
+		switch strings.Split(tok, "=")[0] {
+		case DIRECTIVEENUM, DIRECTIVEFLAGS, DIRECTIVEMIN, DIRECTIVEMAX, DIRECTIVESTEP, DIRECTIVESTEPS, DIRECTIVEBITS:
+			return false
+		}
+	}
+	return true
+}
+
+// stringerName calls String() of value. Panic like index out of range on String() means that value have no name
+func stringerName(ptr reflect.Value) (name string) {
+	defer func() {
+		if recover() != nil {
+			name = ""
+		}
+	}()
+	return ptr.Interface().(fmt.Stringer).String()
+}
+
+// stringerEnums probes names of values 0..MAXSTRINGERCODE. Values printed as number like "Mode(7)", "7", empty or panic are not enums.
+// Names must end before MAXSTRINGERCODE when type have larger values, otherwise names are not all known
+func stringerEnums(t reflect.Type) ([]string, []uint64, error) {
+	names := []string{}
+	codes := []uint64{}
+	ptr := reflect.New(t)
+	v := ptr.Elem()
+	for code := uint64(0); code <= MAXSTRINGERCODE; code++ {
+		if v.CanInt() {
+			if v.OverflowInt(int64(code)) {
+				break
+			}
+			v.SetInt(int64(code))
+		} else {
+			if v.OverflowUint(code) {
+				break
+			}
+			v.SetUint(code)
+		}
+		name := stringerName(ptr)
+		number := strconv.FormatUint(code, 10)
+		if name == "" || name == number || strings.HasSuffix(name, "("+number+")") {
+			continue
+		}
+		larger := (v.CanInt() && !v.OverflowInt(MAXSTRINGERCODE+1)) || (!v.CanInt() && !v.OverflowUint(MAXSTRINGERCODE+1))
+		if code == MAXSTRINGERCODE && larger {
+			return nil, nil, fmt.Errorf("type %v String() gives name for %v, use %v directive with names", t, code, DIRECTIVEENUM)
+		}
+		names = append(names, name)
+		codes = append(codes, code)
+	}
+	return names, codes, nil
+}
+
+// stringerDirectiveIsValid tells is directive used on enum from String(). Other directives are error instead of being ignored
+func stringerDirectiveIsValid(directive string) bool {
+	switch directive {
+	case DIRECTIVEOMIT, DIRECTIVEUNKNOWN, DIRECTIVECONST, DIRECTIVEDEADBAND, DIRECTIVECLAMPED,
+		DIRECTIVE_META_UNIT, DIRECTIVE_META_CAPTION, DIRECTIVE_META_ACCURACY, DIRECTIVE_META_MAXINTERVAL, DIRECTIVE_META_BANDWIDTH:
+		return true
+	}
+	return false
+}
+
+// stringerCoding creates enum coding from String() of integer type. Tag can have metadata, omit, unknown, const (code) and deadband directives
+func stringerCoding(name string, t reflect.Type, tag string) (PiecewiseCoding, error) {
+	dir := DirectiveSettings{}
+	if tag != "" {
+		for _, tok := range strings.Split(tag, ",") {
+			directive := strings.Split(tok, "=")[0]
+			if !stringerDirectiveIsValid(directive) {
+				return PiecewiseCoding{}, fmt.Errorf("%v directive %v is not supported on %v with String(), use %v directive or numeric coding", name, directive, t, DIRECTIVEENUM)
+			}
+		}
+		var dirErr error
+		dir, dirErr = parseDirectives(tag, codingTypename(t))
+		if dirErr != nil {
+			return PiecewiseCoding{}, fmt.Errorf("%v fail %v", name, dirErr.Error())
+		}
+	}
+	result := PiecewiseCoding{
+		Omit:        dir.Omit,
+		Name:        name,
+		Clamped:     true,
+		EnumUnknown: dir.EnumUnknown,
+		Meta:        dir.Meta,
+
+		Deadband:        dir.Deadband,
+		DeadbandDefined: dir.DeadbandDefined,
+	}
+	var errNames error
+	result.Enums, result.EnumCodes, errNames = stringerEnums(t)
+	if errNames != nil {
+		return result, fmt.Errorf("%v %v", name, errNames.Error())
+	}
+	if len(result.Enums) == 0 {
+		return result, fmt.Errorf("%v type %v String() does not give names for values 0..%v", name, t, MAXSTRINGERCODE)
+	}
+	result.Steps = []PiecewiseCodingStep{{Size: 1, Count: result.maxEnumCode()}}
+	if dir.Const != "" { //Checked by parseDirectives
+		result.Const, _ = parseByTypenameToFloat64(dir.Const, codingTypename(t))
+		result.ConstDefined = true
+	}
+	return result, result.enumsIsInvalid()
+}
@@ -0,0 +1,190 @@
+package splurts
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type MachineMeas struct {
+	State string `splurts:"enum=IDLE:1,RUN:5,ERROR:7"`
+	Mode  string `splurts:"unknown=OTHER,enum=AUTO,MANUAL,OTHER:15"`
+	Old   string `splurts:"enum=A,B,C"`
+}
+
+func TestEnumCodes(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(MachineMeas{})
+	assert.Equal(t, nil, errRecipe)
+	assert.Equal(t, []uint64{1, 5, 7}, recipe[0].EnumCodes)
+	assert.Equal(t, 3, recipe[0].NumberOfBits())
+	assert.Equal(t, []uint64{1, 2, 15}, recipe[1].EnumCodes)
+	assert.Equal(t, "OTHER", recipe[1].EnumUnknown)
+	assert.Equal(t, 4, recipe[1].NumberOfBits())
+	assert.Equal(t, []uint64(nil), recipe[2].EnumCodes, "positional codes like before")
+	assert.Equal(t, 2, recipe[2].NumberOfBits())
+
+	d := MachineMeas{State: "RUN", Mode: "SERVICE", Old: "C"}
+	m, errMap := recipe.GetValuesToFloatMap(d)
+	assert.Equal(t, nil, errMap)
+	assert.Equal(t, map[string]float64{"State": 5, "Mode": 15, "Old": 3}, m)
+
+	byt, errSplurt := recipe.Splurts(d)
+	assert.Equal(t, nil, errSplurt)
+	back := MachineMeas{}
+	assert.Equal(t, nil, recipe.UnSplurts(byt, &back))
+	assert.Equal(t, MachineMeas{State: "RUN", Mode: "OTHER", Old: "C"}, back)
+
+	//Unknown code decodes as fallback
+	w := BitWriter{}
+	w.WriteBits(7, 3)
+	w.WriteBits(9, 4)
+	w.WriteBits(0, 2)
+	values, errDecode := recipe.Decode(w.Bytes(), true)
+	assert.Equal(t, nil, errDecode)
+	assert.Equal(t, map[string]float64{"State": 7, "Mode": 15, "Old": 0}, values)
+	assert.Equal(t, nil, recipe.UnSplurts(w.Bytes(), &back))
+	assert.Equal(t, MachineMeas{State: "ERROR", Mode: "OTHER", Old: ""}, back)
+
+	//Unknown code without fallback is error
+	w = BitWriter{}
+	w.WriteBits(3, 3)
+	w.WriteBits(1, 4)
+	w.WriteBits(0, 2)
+	_, errDecode = recipe.Decode(w.Bytes(), true)
+	assert.NotEqual(t, nil, errDecode)
+
+	_, errSplurt = recipe.Splurts(MachineMeas{State: "SLEEP"})
+	assert.NotEqual(t, nil, errSplurt)
+
+	s, _ := recipe[0].ToStringValue(7)
+	assert.Equal(t, "ERROR", s)
+
+	for _, tag := range []string{"enum=A:1,B:1", "enum=A,A", "enum=A:x", "unknown=X,enum=A,B", "unknown=A,min=0,max=1"} {
+		_, errCoding := createPiecewiseCodingFromStruct("A", "string", tag)
+		assert.NotEqual(t, nil, errCoding, tag)
+	}
+}
+
+func TestEnumCodeZero(t *testing.T) {
+	dut, errCoding := createPiecewiseCodingFromStruct("A", "string", "enum=OFF:0,ON")
+	assert.Equal(t, nil, errCoding)
+	assert.Equal(t, []uint64{0, 1}, dut.EnumCodes)
+	code, errCode := dut.EnumCode("OFF")
+	assert.Equal(t, nil, errCode)
+	assert.Equal(t, uint64(0), code)
+	_, errCode = dut.EnumCode("")
+	assert.NotEqual(t, nil, errCode, "empty is not valid when code 0 is used")
+	name, _ := dut.EnumName(0)
+	assert.Equal(t, "OFF", name)
+}
+
+type PumpMode uint8
+
+const (
+	PUMPOFF PumpMode = iota
+	PUMPAUTO
+	PUMPMANUAL
+	PUMPSERVICE
+)
+
+func (m PumpMode) String() string {
+	switch m {
+	case PUMPOFF:
+		return "OFF"
+	case PUMPAUTO:
+		return "AUTO"
+	case PUMPMANUAL:
+		return "MANUAL"
+	case PUMPSERVICE:
+		return "SERVICE"
+	}
+	return fmt.Sprintf("PumpMode(%d)", uint8(m))
+}
+
+type PumpMeas struct {
+	Mode    PumpMode
+	Alarm   int      `splurts:"enum=NONE,LOW,HIGH"`
+	Valve   uint8    `splurts:"unknown=FAULT,enum=CLOSED,OPEN,FAULT:7"`
+	Percent PumpMode `splurts:"min=0,max=100,step=1"` //Numeric coding overrides String()
+}
+
+func TestIntegerEnums(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(PumpMeas{})
+	assert.Equal(t, nil, errRecipe)
+	assert.Equal(t, []string{"OFF", "AUTO", "MANUAL", "SERVICE"}, recipe[0].Enums)
+	assert.Equal(t, []uint64{0, 1, 2, 3}, recipe[0].EnumCodes)
+	assert.Equal(t, 2, recipe[0].NumberOfBits())
+	assert.Equal(t, []uint64{0, 1, 2}, recipe[1].EnumCodes, "integer enums start from 0 like iota")
+	assert.Equal(t, 2, recipe[1].NumberOfBits())
+	assert.Equal(t, 3, recipe[2].NumberOfBits())
+	assert.Equal(t, 0, len(recipe[3].Enums))
+
+	d := PumpMeas{Mode: PUMPMANUAL, Alarm: 2, Valve: 4, Percent: 55}
+	byt, errSplurt := recipe.Splurts(d)
+	assert.Equal(t, nil, errSplurt)
+	back := PumpMeas{}
+	assert.Equal(t, nil, recipe.UnSplurts(byt, &back))
+	assert.Equal(t, PumpMeas{Mode: PUMPMANUAL, Alarm: 2, Valve: 7, Percent: 55}, back, "unknown valve is coded as FAULT")
+
+	strs, errStrings := recipe.ToStrings(d, false)
+	assert.Equal(t, nil, errStrings)
+	assert.Equal(t, map[string]string{"Mode": "MANUAL", "Alarm": "HIGH", "Valve": "FAULT", "Percent": "55"}, strs)
+	csv, errCsv := recipe.ToCsv([]PumpMeas{d, {}}, ";", nil, false)
+	assert.Equal(t, nil, errCsv)
+	assert.Equal(t, "MANUAL;HIGH;FAULT;55\nOFF;NONE;CLOSED;0\n", csv)
+
+	_, errSplurt = recipe.Splurts(PumpMeas{Mode: 9})
+	assert.NotEqual(t, nil, errSplurt)
+	_, errSplurt = recipe.Splurts(PumpMeas{Alarm: -1})
+	assert.NotEqual(t, nil, errSplurt)
+
+	_, errRecipe = GetPiecewisesFromStruct(struct{ Code ErrorCode }{})
+	assert.NotEqual(t, nil, errRecipe, "names continue past probed values")
+	_, errRecipe = GetPiecewisesFromStruct(struct {
+		Code ErrorCode `splurts:"min=0,max=1000,step=1"`
+	}{})
+	assert.Equal(t, nil, errRecipe)
+}
+
+type FanMode uint8
+
+func (m FanMode) String() string {
+	return [...]string{"OFF", "LOW", "HIGH"}[m]
+}
+
+type FanMeas struct {
+	Mode   FanMode `splurts:"deadband=0,unit=mode"`
+	Fixed  FanMode `splurts:"const=2"`
+	Hidden FanMode `splurts:"omit"`
+}
+
+func TestStringerDirectives(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(FanMeas{})
+	assert.Equal(t, nil, errRecipe, "panic on String() means no name")
+	assert.Equal(t, []string{"OFF", "LOW", "HIGH"}, recipe[0].Enums)
+	assert.True(t, recipe[0].DeadbandDefined)
+	assert.Equal(t, "mode", recipe[0].Meta.Unit)
+	assert.True(t, recipe[1].ConstDefined)
+	assert.Equal(t, float64(2), recipe[1].Const)
+	assert.True(t, recipe[2].Omit)
+
+	byt, errSplurt := recipe.Splurts(FanMeas{Mode: 1})
+	assert.Equal(t, nil, errSplurt)
+	back := FanMeas{}
+	assert.Equal(t, nil, recipe.UnSplurts(byt, &back))
+	assert.Equal(t, FanMeas{Mode: 1, Fixed: 2}, back)
+	assert.NotEqual(t, nil, recipe.UnSplurts([]byte{0x40}, &back), "const is checked")
+
+	for _, tag := range []string{"round=floor", "special=A", "log", "const=HIGH"} {
+		_, errCoding := stringerCoding("Mode", reflect.TypeOf(FanMode(0)), tag)
+		assert.NotEqual(t, nil, errCoding, tag)
+	}
+}
+
+type ErrorCode uint16
+
+func (c ErrorCode) String() string {
+	return fmt.Sprintf("E%03d", uint16(c))
+}
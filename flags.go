@@ -0,0 +1,109 @@
+/*
+Bit flag sets. Status word with independent flags is coded one bit per flag, first flag is lowest bit
+*/
+
+package splurts
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	MAXFLAGS       = 53  //Mask is passed as float64
+	FLAGSSEPARATOR = "|" //Separator of flag names on strings like HEATER|ALARM
+)
+
+// integerBits sizes of integer fields that can carry flags, sign bit included
+var integerBits = map[string]int{
+	"int8": 8, "uint8": 8, "int16": 16, "uint16": 16, "int32": 32, "uint32": 32,
+	"int64": 64, "uint64": 64, "int": strconv.IntSize, "uint": strconv.IntSize,
+}
+
+// FlagMask converts flag names to bitmask
+func (p *PiecewiseCoding) FlagMask(names []string) (uint64, error) {
+	result := uint64(0)
+	for _, name := range names {
+		found := false
+		for i, flag := range p.Flags {
+			if flag == name {
+				result |= 1 << uint(i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return result, fmt.Errorf("unknown flag %s for %s (valid flags are %#v)", name, p.Name, p.Flags)
+		}
+	}
+	return result, nil
+}
+
+// FlagNames converts bitmask to names of flags in order of flags
+func (p *PiecewiseCoding) FlagNames(mask uint64) ([]string, error) {
+	if mask>>uint(len(p.Flags)) != 0 {
+		return nil, fmt.Errorf("%s mask %b have bits outside of %v flags", p.Name, mask, len(p.Flags))
+	}
+	result := []string{}
+	for i, flag := range p.Flags {
+		if mask&(1<<uint(i)) != 0 {
+			result = append(result, flag)
+		}
+	}
+	return result, nil
+}
+
+func (p *PiecewiseCoding) flagsToString(f float64) (string, error) {
+	if f < 0 {
+		return "", fmt.Errorf("%s flag mask is negative %v", p.Name, f)
+	}
+	names, errNames := p.FlagNames(uint64(f))
+	return strings.Join(names, FLAGSSEPARATOR), errNames
+}
+
+func (p *PiecewiseCoding) flagsIsInvalid() error {
+	if !p.Clamped {
+		return fmt.Errorf("internal error flags must be clamped not automatic +inf -inf")
+	}
+	if MAXFLAGS < len(p.Flags) {
+		return fmt.Errorf("%v have %v flags, max is %v", p.Name, len(p.Flags), MAXFLAGS)
+	}
+	for i, name := range p.Flags {
+		if name == "" || strings.Contains(name, FLAGSSEPARATOR) {
+			return fmt.Errorf("%v invalid flag name %#v", p.Name, name)
+		}
+		for _, other := range p.Flags[:i] {
+			if other == name {
+				return fmt.Errorf("%v flag %v is defined twice", p.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+func getFlagsField(f reflect.Value, pw *PiecewiseCoding) (float64, error) {
+	names := make([]string, f.Len())
+	for i := range names {
+		names[i] = f.Index(i).String()
+	}
+	mask, errMask := pw.FlagMask(names)
+	return float64(mask), errMask
+}
+
+func setFlagsField(f reflect.Value, pw *PiecewiseCoding, v float64) error {
+	if v < 0 {
+		return fmt.Errorf("%s flag mask is negative %v", pw.Name, v)
+	}
+	names, errNames := pw.FlagNames(uint64(v))
+	if errNames != nil {
+		return errNames
+	}
+	result := reflect.MakeSlice(f.Type(), len(names), len(names))
+	for i, name := range names {
+		result.Index(i).SetString(name)
+	}
+	f.Set(result)
+	return nil
+}
@@ -0,0 +1,70 @@
+package splurts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type HeaterStatus struct {
+	Status uint16   `splurts:"flags=HEATER,FAN,ALARM,DOOR"`
+	Active []string `splurts:"flags=PUMP,VALVE,LAMP,unit=none"`
+	Level  float64  `splurts:"min=0,max=10"`
+}
+
+func TestFlags(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(HeaterStatus{})
+	assert.Equal(t, nil, errRecipe)
+	assert.Equal(t, 3, len(recipe))
+	assert.Equal(t, []string{"HEATER", "FAN", "ALARM", "DOOR"}, recipe[0].Flags)
+	assert.Equal(t, 4, recipe[0].NumberOfBits())
+	assert.Equal(t, []string{"PUMP", "VALVE", "LAMP"}, recipe[1].Flags)
+	assert.Equal(t, "none", recipe[1].Meta.Unit)
+	assert.Equal(t, 3, recipe[1].NumberOfBits())
+
+	d := HeaterStatus{Status: 0b0101, Active: []string{"LAMP", "PUMP"}, Level: 3}
+	m, errMap := recipe.GetValuesToFloatMap(d)
+	assert.Equal(t, nil, errMap)
+	assert.Equal(t, map[string]float64{"Status": 5, "Active": 5, "Level": 3}, m)
+
+	byt, errSplurt := recipe.Splurts(d)
+	assert.Equal(t, nil, errSplurt)
+	back := HeaterStatus{}
+	assert.Equal(t, nil, recipe.UnSplurts(byt, &back))
+	assert.Equal(t, uint16(5), back.Status)
+	assert.Equal(t, []string{"PUMP", "LAMP"}, back.Active)
+
+	strs, errStrings := recipe.ToStrings(d, true)
+	assert.Equal(t, nil, errStrings)
+	assert.Equal(t, "\"HEATER|ALARM\"", strs["Status"])
+	csv, errCsv := recipe.ToCsv([]HeaterStatus{d, {}}, ";", nil, false)
+	assert.Equal(t, nil, errCsv)
+	assert.Equal(t, "HEATER|ALARM;PUMP|LAMP;3\n0\n", csv)
+
+	_, errSplurt = recipe.Splurts(HeaterStatus{Active: []string{"HORN"}})
+	assert.NotEqual(t, nil, errSplurt)
+	_, errSplurt = recipe.Splurts(HeaterStatus{Status: 0x10})
+	assert.NotEqual(t, nil, errSplurt, "bit outside flags")
+
+	for _, c := range []struct{ typename, tag string }{
+		{"uint8", "flags=A,B,C,D,E,F,G,H,I"},
+		{"int8", "flags=A,B,C,D,E,F,G,H"},
+		{"float64", "flags=A"},
+		{"uint8", "flags=A,A"},
+		{"[]string", "min=0,max=1"},
+	} {
+		_, errCoding := createPiecewiseCodingFromStruct("A", c.typename, c.tag)
+		assert.NotEqual(t, nil, errCoding, c.tag)
+	}
+	_, errRecipe = GetPiecewisesFromStruct(struct{ Notes []string }{})
+	assert.NotEqual(t, nil, errRecipe, "slice of strings is only for flags")
+	_, errCoding := createPiecewiseCodingFromStruct("A", "uint8", "flags=A,B,C,D,E,F,G,H")
+	assert.Equal(t, nil, errCoding)
+
+	coding, errNames := createPiecewiseCodingFromStruct("A", "uint16", "flags=A,B,omit")
+	assert.Equal(t, nil, errNames)
+	assert.Equal(t, []string{"A", "B"}, coding.Flags)
+	assert.True(t, coding.Omit, "directive ends names")
+	_, errNames = createPiecewiseCodingFromStruct("A", "uint16", "flags=A,log,B")
+	assert.NotEqual(t, nil, errNames, "B is not name after log directive")
+}
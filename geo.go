@@ -0,0 +1,258 @@
+/*
+Geographic positions. Field with geo directive is coded as latitude and longitude codings named like Pos.Lat and Pos.Lon.
+Step sizes in degrees are calculated from precision in metres. Longitude steps are scaled by cos(latitude) at latitude closest to equator on bounding box
+*/
+
+package splurts
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	GEOLAT = "lat" //Geo label of latitude coding
+	GEOLON = "lon" //Geo label of longitude coding
+
+	EARTHRADIUS = 6371008.8 //Mean radius of earth in metres
+)
+
+// GeoBox is bounding box of positions in degrees
+type GeoBox struct {
+	MinLat float64
+	MinLon float64
+	MaxLat float64
+	MaxLon float64
+}
+
+// GeoPair names of latitude and longitude codings of one position
+type GeoPair struct {
+	Name string //Name of position field
+	Lat  string
+	Lon  string
+}
+
+var geoWorld = GeoBox{MinLat: -90, MinLon: -180, MaxLat: 90, MaxLon: 180}
+
+var geoFieldNames = map[string][]string{ //Accepted field names of position struct, lowercase
+	GEOLAT: {"lat", "latitude"},
+	GEOLON: {"lon", "lng", "long", "longitude"},
+}
+
+// GeoName name of latitude or longitude coding of position field, like Pos.Lat
+func GeoName(name string, axis string) string {
+	return name + "." + strings.ToUpper(axis[:1]) + axis[1:]
+}
+
+// IsGeoField tells is field with tag coded as geo position. Field must be [2]float64 (lat,lon) or struct with Lat and Lon fields
+func IsGeoField(t reflect.Type, tag string) bool {
+	if !hasDirective(tag, DIRECTIVEGEO) {
+		return false
+	}
+	if t.Kind() == reflect.Array {
+		return t.Len() == 2 && isFloatKind(t.Elem().Kind())
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	_, errLat := geoStructField(t, GEOLAT)
+	_, errLon := geoStructField(t, GEOLON)
+	return errLat == nil && errLon == nil
+}
+
+func isFloatKind(k reflect.Kind) bool {
+	return k == reflect.Float64 || k == reflect.Float32
+}
+
+// geoStructField finds latitude or longitude field of position struct
+func geoStructField(t reflect.Type, axis string) (int, error) {
+	found := -1
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		for _, name := range geoFieldNames[axis] {
+			if strings.ToLower(field.Name) == name && isFloatKind(field.Type.Kind()) {
+				if 0 <= found {
+					return -1, fmt.Errorf("%v have multiple %v fields", t, axis)
+				}
+				found = i
+			}
+		}
+	}
+	if found < 0 {
+		return -1, fmt.Errorf("%v does not have float %v field", t, axis)
+	}
+	return found, nil
+}
+
+// appendGeoLeaves adds latitude and longitude leaves of position field
+func appendGeoLeaves(result *[]structLeaf, t reflect.Type, name string, path []fieldStep, tag string) error {
+	for i, axis := range []string{GEOLAT, GEOLON} {
+		step := fieldStep{Index: i, Element: true}
+		var elemType reflect.Type
+		if t.Kind() == reflect.Array {
+			elemType = t.Elem()
+		} else {
+			index, errField := geoStructField(t, axis)
+			if errField != nil {
+				return errField
+			}
+			step = fieldStep{Index: index}
+			elemType = t.Field(index).Type
+		}
+		*result = append(*result, structLeaf{Name: GeoName(name, axis), Path: appendStep(path, step), Type: elemType, Tag: tag, Geo: axis})
+	}
+	return nil
+}
+
+// parseGeoBox parses bounding box in format "minlat minlon|maxlat maxlon" like steps directive
+func parseGeoBox(s string) (GeoBox, error) {
+	corners := strings.Split(s, "|")
+	if len(corners) != 2 {
+		return GeoBox{}, fmt.Errorf("bounding box %#v must be minlat minlon|maxlat maxlon", s)
+	}
+	var values [4]float64
+	for i, corner := range corners {
+		latLon := strings.Split(corner, " ")
+		if len(latLon) != 2 {
+			return GeoBox{}, fmt.Errorf("bounding box corner %#v must be lat lon", corner)
+		}
+		for j, sValue := range latLon {
+			var errValue error
+			values[i*2+j], errValue = strconv.ParseFloat(sValue, 64)
+			if errValue != nil {
+				return GeoBox{}, fmt.Errorf("bounding box corner %#v parse error %v", corner, errValue.Error())
+			}
+		}
+	}
+	result := GeoBox{MinLat: values[0], MinLon: values[1], MaxLat: values[2], MaxLon: values[3]}
+	if result.MinLat < -90 || 90 < result.MaxLat || result.MaxLat <= result.MinLat {
+		return result, fmt.Errorf("bounding box latitudes must be -90..90 and min < max")
+	}
+	if result.MinLon < -180 || 180 < result.MaxLon || result.MaxLon <= result.MinLon {
+		return result, fmt.Errorf("bounding box longitudes must be -180..180 and min < max")
+	}
+	return result, nil
+}
+
+// parseDistance parses distance in metres. Units km, m and cm are accepted, without unit metres
+func parseDistance(s string) (float64, error) {
+	scale := 1.0
+	switch {
+	case strings.HasSuffix(s, "km"):
+		s, scale = strings.TrimSuffix(s, "km"), 1000
+	case strings.HasSuffix(s, "cm"):
+		s, scale = strings.TrimSuffix(s, "cm"), 0.01
+	case strings.HasSuffix(s, "m"):
+		s = strings.TrimSuffix(s, "m")
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	return f * scale, err
+}
+
+// metresPerDegree along meridian, and along parallel on equator
+func metresPerDegree() float64 {
+	return EARTHRADIUS * math.Pi / 180
+}
+
+// minAbsLat latitude closest to equator on box, there longitude degree is longest
+func (p GeoBox) minAbsLat() float64 {
+	if p.MinLat <= 0 && 0 <= p.MaxLat {
+		return 0
+	}
+	return math.Min(math.Abs(p.MinLat), math.Abs(p.MaxLat))
+}
+
+// geoCoding creates latitude or longitude coding. Precision is distance between codes in metres everywhere on bounding box
+func geoCoding(name string, axis string, tag string, typename string) (PiecewiseCoding, error) {
+	dir, dirErr := parseDirectives(tag, typename)
+	if dirErr != nil {
+		return PiecewiseCoding{}, fmt.Errorf("%v fail %v", name, dirErr.Error())
+	}
+	if dir.GeoPrecision <= 0 {
+		return PiecewiseCoding{}, fmt.Errorf("%v geo position requires positive %v", name, DIRECTIVEPRECISION)
+	}
+	if dir.MinDefined || dir.MaxDefined || 0 < len(dir.Steps) || 0 < dir.Bits || dir.Clamped || dir.Circular || dir.Log || 0 < len(dir.Table) || 0 < len(dir.Specials) || dir.Const != "" {
+		return PiecewiseCoding{}, fmt.Errorf("%v geo position is coded by %v and %v only", name, DIRECTIVEPRECISION, DIRECTIVEBBOX)
+	}
+	box := geoWorld
+	if dir.GeoBox != nil {
+		box = *dir.GeoBox
+	}
+	result := PiecewiseCoding{
+		Omit:     dir.Omit,
+		Name:     name,
+		Geo:      axis,
+		Rounding: dir.Rounding,
+		Meta:     dir.Meta,
+
+		Deadband:        dir.Deadband / metresPerDegree(), //Given in metres like precision
+		DeadbandDefined: dir.DeadbandDefined,
+	}
+	lonScale := math.Max(math.Cos(box.minAbsLat()*math.Pi/180), 1e-9) //Degree of longitude is shorter away from equator
+	if result.Meta.Unit == "" {
+		result.Meta.Unit = "deg"
+	}
+	lo, hi := box.MinLat, box.MaxLat
+	step := dir.GeoPrecision / metresPerDegree()
+	if axis == GEOLON {
+		lo, hi = box.MinLon, box.MaxLon
+		step /= lonScale
+		result.Deadband /= lonScale
+	}
+	step = math.Min(step, hi-lo)
+	result.Min = lo
+	result.Steps = []PiecewiseCodingStep{{Size: step, Count: uint64(math.Ceil((hi-lo)/step - roundingTolerance))}}
+	return result, nil
+}
+
+// GeoPairString pair of latitude and longitude strings like "60.16990 24.93840". Missing position is NaN
+func GeoPairString(lat string, lon string) string {
+	if lat == "NaN" && lon == "NaN" {
+		return "NaN"
+	}
+	return lat + " " + lon
+}
+
+// ExportNames names of columns on exports. Latitude and longitude of position are one column named like position field.
+// Exponents of blocks are not exported, elements are values
+func (p *PiecewiseFloats) ExportNames() []string {
+	pairs := p.GeoPairs()
+	result := []string{}
+	for _, a := range *p {
+		if a.isBlockExponent() {
+			continue
+		}
+		name := a.Name
+		for _, pair := range pairs {
+			if name == pair.Lon {
+				name = ""
+			}
+			if name == pair.Lat {
+				name = pair.Name
+			}
+		}
+		if name != "" {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// GeoPairs lists latitude and longitude codings of positions
+func (p *PiecewiseFloats) GeoPairs() []GeoPair {
+	result := []GeoPair{}
+	for _, a := range *p {
+		if a.Geo != GEOLAT {
+			continue
+		}
+		name := strings.TrimSuffix(a.Name, GeoName("", GEOLAT))
+		lon := GeoName(name, GEOLON)
+		if _, errLon := p.getCoding(lon); errLon == nil {
+			result = append(result, GeoPair{Name: name, Lat: a.Name, Lon: lon})
+		}
+	}
+	return result
+}
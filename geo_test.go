@@ -0,0 +1,89 @@
+package splurts
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type GeoPoint struct {
+	Latitude  float64
+	Longitude float64
+}
+
+type AssetMeas struct {
+	Pos     [2]float64 `splurts:"geo,precision=5m"`
+	Local   GeoPoint   `splurts:"geo,precision=1m,bbox=59.8 24.5|60.4 25.3"`
+	Battery float64    `splurts:"min=0,max=5,step=0.1"`
+}
+
+func TestGeoPosition(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(AssetMeas{})
+	assert.Equal(t, nil, errRecipe)
+	assert.Equal(t, []string{"Pos.Lat", "Pos.Lon", "Local.Lat", "Local.Lon", "Battery"}, recipe.Names())
+	assert.Equal(t, []GeoPair{{Name: "Pos", Lat: "Pos.Lat", Lon: "Pos.Lon"}, {Name: "Local", Lat: "Local.Lat", Lon: "Local.Lon"}}, recipe.GeoPairs())
+	assert.Equal(t, GEOLAT, recipe[0].Geo)
+	assert.Equal(t, "deg", recipe[0].Meta.Unit)
+
+	metres := EARTHRADIUS * math.Pi / 180
+	assert.InDelta(t, 5, recipe[0].MinStep()*metres, 1e-9)
+	assert.InDelta(t, 5, recipe[1].MinStep()*metres, 1e-9, "no bbox, equator is worst case")
+	assert.InDelta(t, 1, recipe[2].MinStep()*metres, 1e-9)
+	assert.InDelta(t, 1, recipe[3].MinStep()*metres*math.Cos(59.8*math.Pi/180), 1e-9, "longitude step is wider at north")
+	assert.Equal(t, 22, recipe[0].NumberOfBits())
+	assert.Equal(t, 23, recipe[1].NumberOfBits())
+	assert.Equal(t, 17, recipe[2].NumberOfBits())
+	assert.Equal(t, 16, recipe[3].NumberOfBits())
+
+	d := AssetMeas{Pos: [2]float64{-33.8688, 151.2093}, Local: GeoPoint{Latitude: 60.1699, Longitude: 24.9384}, Battery: 3.7}
+	byt, errSplurt := recipe.Splurts(d)
+	assert.Equal(t, nil, errSplurt)
+	back := AssetMeas{}
+	assert.Equal(t, nil, recipe.UnSplurts(byt, &back))
+	assert.InDelta(t, d.Pos[0], back.Pos[0], recipe[0].QuantizationError())
+	assert.InDelta(t, d.Pos[1], back.Pos[1], recipe[1].QuantizationError())
+	assert.InDelta(t, d.Local.Latitude, back.Local.Latitude, recipe[2].QuantizationError())
+	assert.InDelta(t, d.Local.Longitude, back.Local.Longitude, recipe[3].QuantizationError())
+
+	//Outside of bounding box
+	d.Local.Latitude = 61
+	byt, _ = recipe.Splurts(d)
+	assert.Equal(t, nil, recipe.UnSplurts(byt, &back))
+	assert.True(t, math.IsInf(back.Local.Latitude, 1))
+
+	csv, errCsv := recipe.ToCsv(AssetMeas{Pos: [2]float64{1.5, 2.5}, Local: GeoPoint{Latitude: 60, Longitude: 25}, Battery: 3.7}, ";", nil, false)
+	assert.Equal(t, nil, errCsv)
+	assert.Equal(t, "1.50000 2.50000;60.000000 25.00000;3.7", csv, "positions as lat/lon pairs")
+	assert.Equal(t, []string{"Pos", "Local", "Battery"}, recipe.ExportNames())
+	csv, _ = recipe.ToCsv(AssetMeas{Pos: [2]float64{1.5, 2.5}, Battery: 3.7}, ";", []string{"Battery", "Pos.Lon"}, false)
+	assert.Equal(t, "3.7;2.50000", csv)
+}
+
+type BadGeo struct {
+	Pos float64 `splurts:"geo,precision=5m"`
+}
+
+type BadGeoBox struct {
+	Pos [2]float64 `splurts:"geo,precision=5m,bbox=60 25|59 26"`
+}
+
+type BadGeoMin struct {
+	Pos [2]float64 `splurts:"geo,precision=5m,min=0"`
+}
+
+type BadGeoPrecision struct {
+	Pos [2]float64 `splurts:"geo"`
+}
+
+func TestGeoFails(t *testing.T) {
+	for _, v := range []interface{}{BadGeo{}, BadGeoBox{}, BadGeoMin{}, BadGeoPrecision{}} {
+		_, errRecipe := GetPiecewisesFromStruct(v)
+		assert.NotEqual(t, nil, errRecipe, v)
+	}
+	for s, want := range map[string]float64{"5m": 5, "2.5km": 2500, "30cm": 0.3, "7": 7} {
+		got, errDistance := parseDistance(s)
+		assert.Equal(t, nil, errDistance)
+		assert.InDelta(t, want, got, 1e-12, s)
+	}
+}
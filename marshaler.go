@@ -0,0 +1,85 @@
+/*
+Custom field codecs. Field type that does not map to single float can code itself as several values
+*/
+
+package splurts
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// SplurtsMarshaler is implemented by field types like GPS fixes or status words.
+// Values are spliced to bit layout with names like Field.SubName
+type SplurtsMarshaler interface {
+	SplurtsPiecewises() PiecewiseFloats //Sub schema, called on zero value. Names are relative to field
+	ToFloats() []float64                //Values in same order as sub schema
+	FromFloats(values []float64) error  //Sets values in same order as sub schema. Must accept values returned by ToFloats
+}
+
+var marshalerType = reflect.TypeOf((*SplurtsMarshaler)(nil)).Elem()
+
+// isMarshaler checks pointer receiver because FromFloats needs to modify value
+func isMarshaler(t reflect.Type) bool {
+	return t.Kind() != reflect.Pointer && t.Kind() != reflect.Interface && reflect.PointerTo(t).Implements(marshalerType)
+}
+
+// marshalerPiecewises gets sub schema of marshaler type
+func marshalerPiecewises(t reflect.Type) (PiecewiseFloats, error) {
+	sub := reflect.New(t).Interface().(SplurtsMarshaler).SplurtsPiecewises()
+	if len(sub) == 0 {
+		return nil, fmt.Errorf("%v have empty sub schema", t)
+	}
+	errInv := sub.IsInvalid()
+	if errInv != nil {
+		return nil, fmt.Errorf("%v have invalid sub schema err=%v", t, errInv.Error())
+	}
+	return sub.Clone(), nil
+}
+
+// appendMarshalerLeaves adds one leaf per value of sub schema. Leaves share path to field
+func appendMarshalerLeaves(result *[]structLeaf, t reflect.Type, name string, path []fieldStep) error {
+	sub, errSub := marshalerPiecewises(t)
+	if errSub != nil {
+		return errSub
+	}
+	for k := range sub {
+		coding := sub[k]
+		if name != "" {
+			coding.Name = name + "." + coding.Name
+		}
+		*result = append(*result, structLeaf{Name: coding.Name, Path: path, Type: t, Coding: &coding, Sub: k})
+	}
+	return nil
+}
+
+// toMarshaler returns field as marshaler. Value that is not addressable is copied
+func toMarshaler(f reflect.Value) SplurtsMarshaler {
+	if !f.CanAddr() {
+		tmp := reflect.New(f.Type())
+		tmp.Elem().Set(f)
+		return tmp.Interface().(SplurtsMarshaler)
+	}
+	return f.Addr().Interface().(SplurtsMarshaler)
+}
+
+// marshalerAccessors reads and sets value k of marshaler. Setting is done by replacing one value from ToFloats and calling FromFloats
+func marshalerAccessors(k int) (fieldGetter, fieldSetter) {
+	get := func(f reflect.Value, pw *PiecewiseCoding) (float64, error) {
+		values := toMarshaler(f).ToFloats()
+		if len(values) <= k {
+			return 0, fmt.Errorf("%v ToFloats returned %v values, value %v required", pw.Name, len(values), k)
+		}
+		return values[k], nil
+	}
+	set := func(f reflect.Value, pw *PiecewiseCoding, v float64) error {
+		m := toMarshaler(f)
+		values := m.ToFloats()
+		if len(values) <= k {
+			return fmt.Errorf("%v ToFloats returned %v values, value %v required", pw.Name, len(values), k)
+		}
+		values[k] = v
+		return m.FromFloats(values)
+	}
+	return get, set
+}
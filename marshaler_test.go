@@ -0,0 +1,79 @@
+package splurts
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type GpsFix struct {
+	Lat, Lon float64
+	Valid    bool
+}
+
+func (p *GpsFix) SplurtsPiecewises() PiecewiseFloats {
+	return PiecewiseFloats{
+		{Name: "Lat", Min: -90, Steps: []PiecewiseCodingStep{{Size: 0.0001, Count: 1800000}}},
+		{Name: "Lon", Min: -180, Steps: []PiecewiseCodingStep{{Size: 0.0001, Count: 3600000}}},
+	}
+}
+
+func (p *GpsFix) ToFloats() []float64 {
+	return []float64{p.Lat, p.Lon}
+}
+
+func (p *GpsFix) FromFloats(values []float64) error {
+	if len(values) != 2 {
+		return fmt.Errorf("two values required")
+	}
+	p.Lat = values[0]
+	p.Lon = values[1]
+	p.Valid = true
+	return nil
+}
+
+type TrackerMeas struct {
+	Battery float64 `splurts:"step=0.1,min=0,max=5"`
+	Pos     GpsFix
+	History [2]GpsFix
+	Unused  GpsFix `splurts:"omit"`
+}
+
+func TestSplurtsMarshaler(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(TrackerMeas{})
+	assert.Equal(t, nil, errRecipe)
+	assert.Equal(t, []string{"Battery", "Pos.Lat", "Pos.Lon", "History[0].Lat", "History[0].Lon", "History[1].Lat", "History[1].Lon"}, recipe.Names())
+	assert.Equal(t, 6+3*(21+22), recipe.NumberOfBits())
+
+	d := TrackerMeas{Battery: 3.7, Pos: GpsFix{Lat: 60.1699, Lon: 24.9384}, History: [2]GpsFix{{Lat: -33.8688, Lon: 151.2093}, {Lat: 0, Lon: -0.5}}}
+	byt, errSplurt := recipe.Splurts(d)
+	assert.Equal(t, nil, errSplurt)
+	back := TrackerMeas{}
+	assert.Equal(t, nil, recipe.UnSplurts(byt, &back))
+	assert.True(t, back.Pos.Valid)
+	assert.InDelta(t, d.Pos.Lat, back.Pos.Lat, 0.00005)
+	assert.InDelta(t, d.Pos.Lon, back.Pos.Lon, 0.00005)
+	assert.InDelta(t, d.History[0].Lon, back.History[0].Lon, 0.00005)
+	assert.InDelta(t, d.History[1].Lon, back.History[1].Lon, 0.00005)
+	assert.Equal(t, GpsFix{}, back.Unused)
+
+	codec, errCodec := NewCodec[TrackerMeas]()
+	assert.Equal(t, nil, errCodec)
+	again, errMarshal := codec.Marshal(d)
+	assert.Equal(t, nil, errMarshal)
+	assert.Equal(t, byt, again)
+	typedBack, _ := codec.Unmarshal(again)
+	assert.Equal(t, back, typedBack)
+}
+
+type BadMarshaler struct{}
+
+func (p *BadMarshaler) SplurtsPiecewises() PiecewiseFloats { return nil }
+func (p *BadMarshaler) ToFloats() []float64                { return nil }
+func (p *BadMarshaler) FromFloats(values []float64) error  { return nil }
+
+func TestSplurtsMarshalerFails(t *testing.T) {
+	_, errRecipe := GetPiecewisesFromStruct(struct{ Bad BadMarshaler }{})
+	assert.NotEqual(t, nil, errRecipe)
+}
@@ -7,7 +7,6 @@ package splurts
 import (
 	"fmt"
 	"math"
-	"strconv"
 	"strings"
 )
 
@@ -23,6 +22,28 @@ func (p *PiecewiseFloats) getCoding(name string) (PiecewiseCoding, error) {
 	return PiecewiseCoding{}, fmt.Errorf("name %v not found", name)
 }
 
+// Clone deep copy, steps and enums are not shared
+func (p PiecewiseFloats) Clone() PiecewiseFloats {
+	if p == nil {
+		return nil
+	}
+	result := make(PiecewiseFloats, len(p))
+	for i, a := range p {
+		result[i] = a
+		result[i].Steps = append([]PiecewiseCodingStep(nil), a.Steps...)
+		result[i].Enums = append([]string(nil), a.Enums...)
+		result[i].EnumCodes = append([]uint64(nil), a.EnumCodes...)
+		result[i].Table = append([]CalibrationPoint(nil), a.Table...)
+		result[i].Specials = append([]string(nil), a.Specials...)
+		result[i].Flags = append([]string(nil), a.Flags...)
+		if a.Block != nil { //Elements and exponent are matched by block name, not by pointer
+			block := *a.Block
+			result[i].Block = &block
+		}
+	}
+	return result
+}
+
 func (p PiecewiseFloats) String() string {
 	result := ""
 	for i, a := range p {
@@ -50,21 +71,27 @@ func (p *PiecewiseFloats) NumberOfBits() int {
 
 //Decodes hex string 4bit or 8bit
 func (p *PiecewiseFloats) DecodeHex(hexString string, allowNaN bool) (map[string]float64, error) {
-	s := hexString
-	if len(s)%2 != 0 {
-		s = s + "0"
-	}
-
-	binarr := []byte{}
-	for n := 0; n*2 < len(s); n++ {
-		piece := s[n*2 : n*2+2]
-		v, parseErr := strconv.ParseInt(piece, 16, 64)
-		if parseErr != nil {
+	w := NewBitWriter(make([]byte, 0, (len(hexString)+1)/2))
+	for i := 0; i < len(hexString); i++ {
+		v, ok := hexNybble(hexString[i])
+		if !ok {
 			return nil, fmt.Errorf("Invalid hex string")
 		}
-		binarr = append(binarr, byte(v))
+		w.WriteBits(uint64(v), 4)
 	}
-	return p.Decode(binarr, allowNaN)
+	return p.Decode(w.Bytes(), allowNaN)
+}
+
+func hexNybble(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
 }
 
 func (p *PiecewiseFloats) NumberOfBytes() int {
@@ -81,41 +108,72 @@ func (p *PiecewiseFloats) Decode(binarr []byte, allowNaN bool) (map[string]float
 	}
 
 	result := make(map[string]float64)
-	binstr := ""
-	for _, b := range binarr {
-		binstr += fmt.Sprintf("%08b", b)
+	errDecode := p.decodeEach(binarr, func(i int, a *PiecewiseCoding, v float64) error {
+		if !math.IsNaN(v) || allowNaN {
+			result[a.Name] = v
+		}
+		return nil
+	})
+	return result, errDecode
+}
+
+// DecodeInto decodes byte array to values indexed same way as PiecewiseFloats. Missing values are NaN.
+// Omitted values are left untouched. Does not allocate, for high rate use
+func (p *PiecewiseFloats) DecodeInto(binarr []byte, values []float64) error {
+	if len(values) < len(*p) {
+		return fmt.Errorf("have %v codings but only %v values", len(*p), len(values))
 	}
+	return p.decodeEach(binarr, func(i int, a *PiecewiseCoding, v float64) error {
+		values[i] = v
+		return nil
+	})
+}
 
-	for _, a := range *p {
+// decodeEach checks and decodes codes in order, calls fn for each non omitted value
+func (p *PiecewiseFloats) decodeEach(binarr []byte, fn func(i int, a *PiecewiseCoding, v float64) error) error {
+	if p.NumberOfBytes() != len(binarr) {
+		return fmt.Errorf("Struct have %v bits means %v bytes. BUT binary array have %v bytes",
+			p.NumberOfBits(),
+			p.NumberOfBytes(),
+			len(binarr))
+	}
+	r := BitReader{buf: binarr}
+	exponent := math.NaN() //Of latest block
+	for i := range *p {
+		a := &(*p)[i]
 		if a.Omit {
 			continue
 		}
-		//Pick bits for variable
-		bits := a.NumberOfBits()
-		piece := binstr[0:bits]
-		binstr = binstr[bits:]
-
-		pieceval, errParse := strconv.ParseInt(piece, 2, 64)
-		if errParse != nil { //Non-unit testable
-			return result, fmt.Errorf("internal parse error can not happen err=%v  (piece=%v, bits=%v)", errParse, piece, a.NumberOfBits())
+		pieceval, errRead := r.ReadBits(a.NumberOfBits())
+		if errRead != nil {
+			return errRead
 		}
-
-		if 0 < len(a.Enums) {
-			if len(a.Enums) < int(pieceval) {
-				return result, fmt.Errorf("variable %s have value %v, but it have %v enums + empty", a.Name, pieceval, len(a.Enums))
-			}
-			result[a.Name] = float64(pieceval)
+		v, errCode := a.decodeCode(pieceval, &exponent)
+		if errCode != nil {
+			return errCode
 		}
-
-		v := a.ScaleToFloat(uint64(pieceval))
-		if !math.IsNaN(v) || (allowNaN && math.IsNaN(v)) {
-			result[a.Name] = v
+		errFn := fn(i, a, v)
+		if errFn != nil {
+			return errFn
 		}
-		if a.ConstDefined && a.Const != v {
-			return result, fmt.Errorf("const field %v is %v not %v", a.Name, v, a.Const)
+	}
+	return nil
+}
+
+// decodeCode converts code to value and checks enum and const. Exponent is of latest block
+func (a *PiecewiseCoding) decodeCode(code uint64, exponent *float64) (float64, error) {
+	if 0 < len(a.Enums) { //Unknown codes are decoded as EnumUnknown
+		var errEnum error
+		code, errEnum = a.decodeEnum(code)
+		if errEnum != nil {
+			return 0, errEnum
 		}
 	}
-	return result, nil
+	v := a.valueOf(code, exponent)
+	if a.ConstDefined && a.Const != v {
+		return v, fmt.Errorf("const field %v is %v not %v", a.Name, v, a.Const)
+	}
+	return v, nil
 }
 
 //Formatted to 7bit
@@ -123,42 +181,45 @@ type SevenBitArr []byte
 
 //Decode7bitBytes decode, skipping MSB from
 func (p *PiecewiseFloats) Decode7bitBytes(binarr SevenBitArr, allowNaN bool) (map[string]float64, error) {
+	binarr8, errConv := p.sevenBitToBytes(binarr)
+	if errConv != nil {
+		return nil, errConv
+	}
+	return p.Decode(binarr8, allowNaN)
+}
+
+// sevenBitToBytes removes MSB bits and trims to record length
+func (p *PiecewiseFloats) sevenBitToBytes(binarr SevenBitArr) ([]byte, error) {
 	if len(binarr) == 0 {
 		return nil, fmt.Errorf("No data")
 	}
-	//Naive solution, optimize later
-	var sb strings.Builder
+	bits := p.NumberOfBits()
+	if len(binarr)*7 < bits {
+		return nil, fmt.Errorf("Not enough bits")
+	}
 	//Remove zero bits from array
+	w := NewBitWriter(make([]byte, 0, p.NumberOfBytes()))
 	for i, b := range binarr {
 		if 127 < b {
 			return nil, fmt.Errorf("Non 7-bit byte vector at index %v on %#X", i, binarr)
 		}
-		sb.WriteString(fmt.Sprintf("%.7b", b))
-	}
-
-	//Trim to expected length and split
-	s := sb.String()
-	bits := p.NumberOfBits()
-	if len(s) < bits {
-		return nil, fmt.Errorf("Not enough bits")
-	}
-	arr := splitFixedSizePieces(s[:bits], 8)
-	//Pad if needed.. add AFTER zeros
-	last := len(arr) - 1
-	for len(arr[last]) < 8 {
-		arr[last] += "0"
-	}
-
-	result := make([]byte, len(arr))
-	for i, v := range arr {
-		intv, _ := strconv.ParseInt(v, 2, 16)
-		result[i] = byte(intv)
+		//Trim to expected length. Padding after is zeros
+		n := bits - w.Len()
+		if 7 <= n {
+			w.WriteBits(uint64(b), 7)
+		} else if 0 < n {
+			w.WriteBits(uint64(b>>uint(7-n)), n)
+		}
 	}
-	return p.Decode(result, allowNaN)
+	return w.Bytes(), nil
 }
 
 //IsInvalid check with this before further proceccing
 func (p *PiecewiseFloats) IsInvalid() error {
+	errBlocks := p.blocksIsInvalid()
+	if errBlocks != nil {
+		return errBlocks
+	}
 	for i, a := range *p {
 		if a.Omit {
 			continue
@@ -170,47 +231,75 @@ func (p *PiecewiseFloats) IsInvalid() error {
 		if errValid != nil {
 			return fmt.Errorf("Name is %v not valid: %v (%#v)", a.Name, errValid.Error(), a)
 		}
+		if a.RelativeTo != "" {
+			_, errEpoch := p.getCoding(a.RelativeTo)
+			if errEpoch != nil {
+				return fmt.Errorf("%v is relative to missing epoch: %v", a.Name, errEpoch.Error())
+			}
+		}
 	}
 	return nil
 }
 
-func (p *PiecewiseFloats) EncodeToBitString(values map[string]float64) string {
-	bitString := ""
-	for _, a := range *p {
+// EncodeToBitWriter writes codes of values to bit stream. Missing values are coded with max code
+func (p *PiecewiseFloats) EncodeToBitWriter(w *BitWriter, values map[string]float64) {
+	exponent := math.NaN() //Of latest block
+	for i, a := range *p {
 		if a.Omit {
 			continue
 		}
 		f, haz := values[a.Name]
+		if a.isBlockExponent() { //Picked by values of elements
+			f, _ = p.blockExponent(i, func(j int) (float64, error) {
+				v, hazElement := values[(*p)[j].Name]
+				if !hazElement {
+					return math.NaN(), nil
+				}
+				return v, nil
+			})
+			haz = true
+		}
 		if haz {
-			s, _ := a.BitCode(f)
-			bitString += s
+			if a.ConstDefined {
+				f = a.Const
+			}
+			w.WriteBits(a.codeOf(f, &exponent), a.NumberOfBits())
 		} else {
-			bitString += fmt.Sprintf("%b", a.MaxCode())
+			w.WriteBits(a.missingCode(), a.NumberOfBits())
 		}
 	}
-	return bitString
+}
+
+func (p *PiecewiseFloats) EncodeToBitString(values map[string]float64) string {
+	w := NewBitWriter(make([]byte, 0, p.NumberOfBytes()))
+	p.EncodeToBitWriter(w, values)
+	return w.String()
 }
 
 //pad to 4bit
 func (p *PiecewiseFloats) EncodeToHexNybble(values map[string]float64) (string, error) {
-	bitString := p.EncodeToBitString(values)
-	neededPad := 4 - (len(bitString) % 4)
-	if 0 < neededPad {
-		padformat := "%0" + fmt.Sprintf("%v", neededPad) + "b"
-		bitString = bitString + fmt.Sprintf(padformat, 0)
+	errCircular := p.circularMapIsInvalid(values)
+	if errCircular != nil {
+		return "", errCircular
 	}
-
-	length := len(bitString)
-	result := ""
-	for n := 0; n*4 < length; n++ {
-		piece := bitString[n*4 : n*4+4]
-		v, parseErr := strconv.ParseInt(piece, 2, 64)
-		if parseErr != nil {
-			return result, fmt.Errorf("Code internal failure %v", parseErr) //can not happen
+	w := NewBitWriter(make([]byte, 0, p.NumberOfBytes()+1))
+	p.EncodeToBitWriter(w, values)
+	//Always at least one padding nybble
+	nybbleCount := w.Len()/4 + 1
+	const hexchars = "0123456789ABCDEF"
+	result := make([]byte, nybbleCount)
+	for i, b := range w.Bytes() {
+		if i*2 < nybbleCount {
+			result[i*2] = hexchars[b>>4]
+		}
+		if i*2+1 < nybbleCount {
+			result[i*2+1] = hexchars[b&0xF]
 		}
-		result += fmt.Sprintf("%X", v)
 	}
-	return result, nil
+	for i := (len(w.Bytes()) * 2); i < nybbleCount; i++ {
+		result[i] = '0'
+	}
+	return string(result), nil
 }
 
 //pad so it will fit to 8bit
@@ -222,53 +311,68 @@ func (p *PiecewiseFloats) EncodeToHex(values map[string]float64) (string, error)
 	return result, err
 }
 
-func bitStringToByteArr(bitString string) ([]byte, error) {
-	neededPad := 8 - (len(bitString) % 8)
-	if (0 != neededPad) && (8 != neededPad) {
-		padformat := "%0" + fmt.Sprintf("%v", neededPad) + "b"
-		bitString = bitString + fmt.Sprintf(padformat, 0)
-	}
-	length := len(bitString)
-	result := []byte{}
-
-	for n := 0; n*8 < length; n++ {
-		piece := bitString[n*8 : n*8+8]
-		v, parseErr := strconv.ParseInt(piece, 2, 64)
-		if parseErr != nil {
-			return result, fmt.Errorf("Code internal failure %v", parseErr)
-		}
-		result = append(result, byte(v))
-	}
-	//Split array in 8 long pieces
-	return result, nil
-}
-
 //Encode map of float values to byte struct. Low level function. Call Splurts
 func (p *PiecewiseFloats) Encode(values map[string]float64) ([]byte, error) {
-	return bitStringToByteArr(p.EncodeToBitString(values))
+	errCircular := p.circularMapIsInvalid(values)
+	if errCircular != nil {
+		return nil, errCircular
+	}
+	w := NewBitWriter(make([]byte, 0, p.NumberOfBytes()))
+	p.EncodeToBitWriter(w, values)
+	return w.Bytes(), nil
 }
 
-func splitFixedSizePieces(s string, step int) []string {
-	arr := make([]string, int(math.Ceil(float64(len(s))/float64(step))))
-	for i := range arr {
-		arr[i] = s[i*step : int(math.Min(float64(len(s)), float64((i+1)*step)))]
+// AppendEncode appends coded values (indexed same way as PiecewiseFloats) to dst. Use NaN for missing values.
+// Does not allocate when dst have enough capacity
+func (p *PiecewiseFloats) AppendEncode(dst []byte, values []float64) ([]byte, error) {
+	if len(values) < len(*p) {
+		return dst, fmt.Errorf("have %v codings but only %v values", len(*p), len(values))
+	}
+	errCircular := p.circularValuesIsInvalid(values)
+	if errCircular != nil {
+		return dst, errCircular
 	}
-	return arr
+	w := BitWriter{buf: dst, start: len(dst)}
+	exponent := math.NaN() //Of latest block
+	for i := range *p {
+		a := &(*p)[i]
+		if a.Omit {
+			continue
+		}
+		f := values[i]
+		if a.isBlockExponent() { //Picked by values of elements
+			f, _ = p.blockExponent(i, func(j int) (float64, error) { return values[j], nil })
+		}
+		if a.ConstDefined {
+			f = a.Const
+		}
+		w.WriteBits(a.codeOf(f, &exponent), a.NumberOfBits())
+	}
+	return w.buf, nil
 }
 
 //Encode7bitBytes  used in FPGA projects when MSB bit reserved for data/command flag
 func (p *PiecewiseFloats) Encode7bitBytes(values map[string]float64) (SevenBitArr, error) {
-	s := p.EncodeToBitString(values)
-	pieces := splitFixedSizePieces(s, 7)
-	if len(pieces) == 0 {
+	errCircular := p.circularMapIsInvalid(values)
+	if errCircular != nil {
+		return nil, errCircular
+	}
+	w := NewBitWriter(make([]byte, 0, p.NumberOfBytes()))
+	p.EncodeToBitWriter(w, values)
+	bits := w.Len()
+	if bits == 0 {
 		return nil, nil
 	}
-	neededPad := 7 - (len(pieces[len(pieces)-1]) % 7)
-
-	if (neededPad != 0) && (neededPad != 7) {
-		padformat := "%0" + fmt.Sprintf("%v", neededPad) + "b"
-		pieces[len(pieces)-1] = pieces[len(pieces)-1] + fmt.Sprintf(padformat, 0)
+	//add one front zero per 7bit byte -> 8bit byte. Last one padded with zeros
+	r := NewBitReader(w.Bytes())
+	result := make(SevenBitArr, (bits+6)/7)
+	for i := range result {
+		n := bits - i*7
+		if 7 < n {
+			n = 7
+		}
+		v, _ := r.ReadBits(n)
+		result[i] = byte(v << uint(7-n))
 	}
-	result := "0" + strings.Join(pieces, "0")
-	return bitStringToByteArr(result) //add one front zero per 7bit byte -> 8bit byte
+	return result, nil
 }
@@ -3,6 +3,8 @@ package splurts
 import (
 	"math"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestExample(t *testing.T) {
@@ -214,3 +216,46 @@ func TestHex(t *testing.T) {
 	}
 
 }
+
+func TestAppendEncodeDecodeInto(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(ParticleMeas{})
+	if errRecipe != nil {
+		t.Fatal(errRecipe)
+	}
+	d := ParticleMeas{SystemStatus: "IDLE", Temperature: 18.3, Humidity: 23.6, Pressure: 102400, Small: 23.2, Large: 41, Emptyvalue: "YES"}
+	m, _ := recipe.GetValuesToFloatMap(d)
+	ref, _ := recipe.Encode(m)
+
+	values := make([]float64, len(recipe))
+	for i, pw := range recipe {
+		values[i] = m[pw.Name]
+	}
+	buf := make([]byte, 0, 64)
+	buf, errAppend := recipe.AppendEncode(buf, values)
+	assert.Equal(t, nil, errAppend)
+	assert.Equal(t, ref, buf)
+
+	decoded := make([]float64, len(recipe))
+	errDecode := recipe.DecodeInto(buf, decoded)
+	assert.Equal(t, nil, errDecode)
+	decodedMap, _ := recipe.Decode(buf, true)
+	for i, pw := range recipe {
+		assert.Equal(t, decodedMap[pw.Name], decoded[i], pw.Name)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		buf, _ = recipe.AppendEncode(buf[:0], values)
+		recipe.DecodeInto(buf, decoded)
+	})
+	assert.Equal(t, float64(0), allocs)
+
+	values[1] = math.NaN() //Temperature missing
+	buf, _ = recipe.AppendEncode(buf[:0], values)
+	assert.Equal(t, nil, recipe.DecodeInto(buf, decoded))
+	assert.True(t, math.IsNaN(decoded[1]))
+
+	assert.NotEqual(t, nil, recipe.DecodeInto(buf, decoded[:2]))
+	assert.NotEqual(t, nil, recipe.DecodeInto(buf[:3], decoded))
+	_, errAppend = recipe.AppendEncode(nil, values[:3])
+	assert.NotEqual(t, nil, errAppend)
+}
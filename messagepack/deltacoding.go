@@ -2,7 +2,7 @@
 Functions for creating delta coding in messagepack integer vector.
 Int does not introduce rounding error
 
-Supports two levels of delta encoding
+Supports two levels of delta encoding. Circular codes are delta coded modulo number of codes, so delta is shortest signed way around
 */
 package messagepack
 
@@ -17,8 +17,13 @@ import (
 type DeltaRLEVec []byte
 
 func CreateDeltaRLEVec(inputArr []int64, deltas int, rleLimit int) (DeltaRLEVec, error) {
+	return CreateDeltaRLEVecModulo(inputArr, deltas, rleLimit, 0)
+}
+
+// CreateDeltaRLEVecModulo delta codes circular codes 0..modulo-1. Modulo 0 is normal delta coding
+func CreateDeltaRLEVecModulo(inputArr []int64, deltas int, rleLimit int, modulo int64) (DeltaRLEVec, error) {
 	for d := 0; d < deltas; d++ {
-		inputArr = DeltaVec(inputArr)
+		inputArr = DeltaVecModulo(inputArr, modulo)
 	}
 	b := new(bytes.Buffer)
 	rleWriteErr := ArrToMessagepack(b, inputArr)
@@ -97,6 +102,11 @@ func ReadDeltaRLEVec(buf io.Reader) (DeltaRLEVec, error) {
 }
 
 func (p *DeltaRLEVec) ToArr(deltas int) ([]int64, error) {
+	return p.ToArrModulo(deltas, 0)
+}
+
+// ToArrModulo reverts CreateDeltaRLEVecModulo. Modulo 0 is normal delta coding
+func (p *DeltaRLEVec) ToArrModulo(deltas int, modulo int64) ([]int64, error) {
 	if 2 < deltas {
 		return nil, fmt.Errorf("number of deltas %v not supported", deltas)
 	}
@@ -108,7 +118,7 @@ func (p *DeltaRLEVec) ToArr(deltas int) ([]int64, error) {
 	}
 
 	for d := 0; d < deltas; d++ {
-		unpacked = UnDeltaVec(unpacked)
+		unpacked = UnDeltaVecModulo(unpacked, modulo)
 	}
 
 	return unpacked, nil
@@ -126,13 +136,18 @@ func (p *DeltaRLEVec) WriteToBuf(w io.Writer) error {
 }
 
 func DeltaVec(values []int64) []int64 {
+	return DeltaVecModulo(values, 0)
+}
+
+// DeltaVecModulo takes shortest signed delta between circular codes 0..modulo-1. Modulo 0 is normal delta
+func DeltaVecModulo(values []int64, modulo int64) []int64 {
 	if len(values) == 0 {
 		return nil
 	}
 	result := make([]int64, len(values))
 	previous := values[0]
 	for i, v := range values {
-		result[i] = v - previous
+		result[i] = shortestDelta(v-previous, modulo)
 		previous = v
 	}
 	result[0] = values[0] //First is 0 anyways, use that for setting that as start value
@@ -140,6 +155,11 @@ func DeltaVec(values []int64) []int64 {
 }
 
 func UnDeltaVec(v []int64) []int64 {
+	return UnDeltaVecModulo(v, 0)
+}
+
+// UnDeltaVecModulo reverts DeltaVecModulo, values are wrapped back to 0..modulo-1
+func UnDeltaVecModulo(v []int64, modulo int64) []int64 {
 	if len(v) < 2 {
 		return nil
 	}
@@ -147,11 +167,35 @@ func UnDeltaVec(v []int64) []int64 {
 	result := make([]int64, n)
 	result[0] = v[0]
 	for i := 1; i < n; i++ {
-		result[i] = result[i-1] + v[i]
+		result[i] = wrapModulo(result[i-1]+v[i], modulo)
 	}
 	return result
 }
 
+// wrapModulo brings value to 0..modulo-1. Modulo 0 does nothing
+func wrapModulo(v int64, modulo int64) int64 {
+	if modulo <= 0 {
+		return v
+	}
+	v %= modulo
+	if v < 0 {
+		v += modulo
+	}
+	return v
+}
+
+// shortestDelta signed delta between -modulo/2 and modulo/2. Modulo 0 does nothing
+func shortestDelta(d int64, modulo int64) int64 {
+	if modulo <= 0 {
+		return d
+	}
+	d = wrapModulo(d, modulo)
+	if modulo/2 < d {
+		d -= modulo
+	}
+	return d
+}
+
 func writeRLE(w io.Writer, value int64, count int64, rleLimit int64) (int64, error) {
 	if rleLimit <= count && 0 < rleLimit {
 		e := WriteArray(w, 2)
@@ -59,6 +59,22 @@ func TestDeltaUndelta(t *testing.T) {
 	assert.Equal(t, inputdata, UnDeltaVec(UnDeltaVec(DeltaVec(DeltaVec(inputdata)))))
 }
 
+func TestDeltaModulo(t *testing.T) {
+	inputdata := []int64{718, 719, 0, 2, 1, 719, 360, 0}
+	delted := DeltaVecModulo(inputdata, 720)
+	assert.Equal(t, []int64{718, 1, 1, 2, -1, -2, -359, 360}, delted, "shortest way around")
+	assert.Equal(t, inputdata, UnDeltaVecModulo(delted, 720))
+	assert.Equal(t, inputdata, UnDeltaVecModulo(UnDeltaVecModulo(DeltaVecModulo(DeltaVecModulo(inputdata, 720), 720), 720), 720))
+
+	for deltas := 0; deltas <= 2; deltas++ {
+		dat, err := CreateDeltaRLEVecModulo(inputdata, deltas, 2, 720)
+		assert.Equal(t, nil, err)
+		ref, errRef := dat.ToArrModulo(deltas, 720)
+		assert.Equal(t, nil, errRef)
+		assert.Equal(t, inputdata, ref)
+	}
+}
+
 func TestOneDelta(t *testing.T) {
 	b := new(bytes.Buffer)
 	inputdata := []int64{6, 2, 2, 4, 1, 4, 4, 4}
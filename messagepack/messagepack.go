@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"time"
+
+	"github.com/hjkoskel/splurts"
 )
 
 const (
@@ -20,10 +23,22 @@ const (
 	MPNAME_META_BANDWIDTH   = "bandwidth"
 )
 const (
-	MPNAME_CODING         = "coding"
-	MPNAME_CODING_MIN     = "min"
-	MPNAME_CODING_MAX     = "max"
-	MPNAME_CODING_CLAMPED = "cla"
+	MPNAME_CODING             = "coding"
+	MPNAME_CODING_MIN         = "min"
+	MPNAME_CODING_MAX         = "max"
+	MPNAME_CODING_CLAMPED     = "cla"
+	MPNAME_CODING_RELATIVE    = "rel"      //Name of metric that values are relative to. Only written when used
+	MPNAME_CODING_LOG         = "log"      //Steps are relative, in log space. Only written when used
+	MPNAME_CODING_TABLE       = "table"    //Calibration table as [code,value] pairs. Used instead of steps. Only written when used
+	MPNAME_CODING_SPECIAL     = "special"  //Names of special codes, first is just below +inf code. Only written when used
+	MPNAME_CODING_ENUMCODES   = "ecodes"   //Explicit codes of enums, same order as enums. Only written when used
+	MPNAME_CODING_ENUMUNKNOWN = "eunknown" //Enum name of unknown codes. Only written when used
+	MPNAME_CODING_FLAGS       = "flags"    //Names of bit flags, first is lowest bit. Only written when used
+	MPNAME_CODING_TEXT        = "text"     //Max length of fixed length text. Only written when used
+	MPNAME_CODING_ALPHABET    = "alphabet" //Alphabet of text like sixbit. Only written when used
+	MPNAME_CODING_CIRCULAR    = "circ"     //Values wrap around from max to min, deltas are shortest way around. Only written when used
+	MPNAME_CODING_GEO         = "geo"      //lat or lon when metric is part of geo position, pair is named like pos.Lat and pos.Lon. Only written when used
+	MPNAME_CODING_FLOAT       = "float"    //Reduced precision float format like e5m10, codes are float bits and steps are empty. Only written when used
 )
 
 const (
@@ -38,8 +53,20 @@ const (
 	MPCODING_DELTA2ARR = "delta2"
 )
 
-func getMessagepackTagString(input interface{}) (map[string]string, error) {
-	result := make(map[string]string)
+// messagepackTag is messagepack directive string of flattened splurts value
+type messagepackTag struct {
+	Tag    string
+	Prefix string //Nested struct path before field name. Kept when name is overridden
+	Suffix string //Array indexes after field name. Kept when name is overridden
+}
+
+// rename applies name override from directives so that nested and array values keep unique names
+func (p *messagepackTag) rename(name string) string {
+	return p.Prefix + name + p.Suffix
+}
+
+func getMessagepackTags(input interface{}) (map[string]messagepackTag, error) {
+	result := make(map[string]messagepackTag)
 	rt := reflect.TypeOf(input)
 
 	switch rt.Kind() {
@@ -49,22 +76,72 @@ func getMessagepackTagString(input interface{}) (map[string]string, error) {
 			return nil, fmt.Errorf("no slice items")
 		}
 		item := vo.Index(0)
-		return getMessagepackTagString(item.Interface())
+		return getMessagepackTags(item.Interface())
 	case reflect.Struct:
-		t := reflect.TypeOf(input)
-		for i := 0; i < t.NumField(); i++ {
-			field := t.Field(i)
-			tag := field.Tag.Get(MPDIRECTIVE)
-			if tag != "" {
-				result[field.Name] = tag
-			}
-		}
+		addMessagepackTags(result, rt, "")
 	default:
 		return nil, fmt.Errorf("unknown kind of %v", rt.Kind())
 	}
 	return result, nil
 }
 
+// addMessagepackTags collects tags with same flattened names as splurts uses. Nested structs are Parent.Field, embedded are promoted, array elements are Field[3]
+func addMessagepackTags(result map[string]messagepackTag, t reflect.Type, prefix string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && isNestedStruct(field.Type) {
+			addMessagepackTags(result, field.Type, prefix)
+			continue
+		}
+		addValueTags(result, field.Type, prefix, field.Name, "", field.Tag.Get(MPDIRECTIVE), field.Tag.Get(splurts.SPLURTS))
+	}
+}
+
+func addValueTags(result map[string]messagepackTag, t reflect.Type, prefix string, fieldName string, suffix string, tag string, splurtsTag string) {
+	if isMarshaler(t) { //Tag is used for every value of sub schema
+		if tag == "" {
+			return
+		}
+		sub := reflect.New(t).Interface().(splurts.SplurtsMarshaler).SplurtsPiecewises()
+		for _, coding := range sub {
+			subSuffix := suffix + "." + coding.Name
+			result[prefix+fieldName+subSuffix] = messagepackTag{Tag: tag, Prefix: prefix, Suffix: subSuffix}
+		}
+		return
+	}
+	if splurts.IsGeoField(t, splurtsTag) { //Tag is used for latitude and longitude
+		if tag == "" {
+			return
+		}
+		for _, axis := range []string{splurts.GEOLAT, splurts.GEOLON} {
+			subSuffix := splurts.GeoName(suffix, axis)
+			result[prefix+fieldName+subSuffix] = messagepackTag{Tag: tag, Prefix: prefix, Suffix: subSuffix}
+		}
+		return
+	}
+	if isNestedStruct(t) {
+		addMessagepackTags(result, t, prefix+fieldName+suffix+".")
+		return
+	}
+	if t.Kind() == reflect.Array {
+		for j := 0; j < t.Len(); j++ {
+			addValueTags(result, t.Elem(), prefix, fieldName, fmt.Sprintf("%s[%v]", suffix, j), tag, splurtsTag)
+		}
+		return
+	}
+	if tag != "" {
+		result[prefix+fieldName+suffix] = messagepackTag{Tag: tag, Prefix: prefix, Suffix: suffix}
+	}
+}
+
+func isNestedStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != reflect.TypeOf(time.Time{}) && !isMarshaler(t)
+}
+
+func isMarshaler(t reflect.Type) bool {
+	return t.Kind() != reflect.Pointer && t.Kind() != reflect.Interface && reflect.PointerTo(t).Implements(reflect.TypeOf((*splurts.SplurtsMarshaler)(nil)).Elem())
+}
+
 func splitTags(s string) map[string]string {
 	arr := strings.Split(s, ",")
 
@@ -3,7 +3,9 @@ package messagepack
 import (
 	"bytes"
 	"fmt"
+	"math"
 	"testing"
+	"time"
 
 	"github.com/hjkoskel/splurts"
 	"github.com/stretchr/testify/assert"
@@ -89,3 +91,478 @@ func TestSimple(t *testing.T) {
 	}
 
 }
+
+type EnvMeas struct {
+	Temp float64 `splurts:"step=0.1,min=-40,max=40" messagepack:"delta=1"`
+	Hum  float64 `splurts:"step=0.5,min=0,max=100"`
+}
+
+type NestedMeas struct {
+	Indoor  EnvMeas
+	Outdoor EnvMeas
+	Counter int `splurts:"min=0,max=1000" messagepack:"cnt"`
+}
+
+func TestNested(t *testing.T) {
+	testArr := []NestedMeas{
+		{Indoor: EnvMeas{Temp: 21.5, Hum: 40}, Outdoor: EnvMeas{Temp: -5.2, Hum: 80.5}, Counter: 1},
+		{Indoor: EnvMeas{Temp: 21.6, Hum: 40}, Outdoor: EnvMeas{Temp: -5.4, Hum: 81}, Counter: 2},
+	}
+	recipe, errRecipe := splurts.GetPiecewisesFromStruct(NestedMeas{})
+	assert.Equal(t, nil, errRecipe)
+
+	mm, err := SplurtsArrToMetricArrMap(recipe, testArr)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, mm["Indoor.Temp"].Delta)
+
+	codebuf := new(bytes.Buffer)
+	assert.Equal(t, nil, mm.Write(codebuf))
+	metricsBack, backErr := ReadMetricsArrMap(codebuf)
+	assert.Equal(t, nil, backErr)
+
+	tabulated, errTabulate := metricsBack.TabulateValues([]string{"Indoor.Temp", "Outdoor.Temp", "Outdoor.Hum", "cnt"}, "\t")
+	assert.Equal(t, nil, errTabulate)
+	assert.Equal(t, "21.5\t-5.2\t80.5\t1\n21.6\t-5.4\t81.0\t2\n", tabulated)
+}
+
+type AdcSample struct {
+	Ch      [4]float64 `splurts:"min=0,max=2.5,step=0.01,clamped" messagepack:"ch,delta=1"`
+	Sensors [2]EnvMeas
+}
+
+func TestArrayFields(t *testing.T) {
+	testArr := []AdcSample{
+		{Ch: [4]float64{0, 0.5, 1, 2.3}, Sensors: [2]EnvMeas{{Temp: 20.1, Hum: 30}, {Temp: -3, Hum: 99.5}}},
+		{Ch: [4]float64{0.1, 0.6, 1.1, 2.4}, Sensors: [2]EnvMeas{{Temp: 20.2, Hum: 31}, {Temp: -3.1, Hum: 99}}},
+	}
+	recipe, errRecipe := splurts.GetPiecewisesFromStruct(AdcSample{})
+	assert.Equal(t, nil, errRecipe)
+
+	mm, err := SplurtsArrToMetricArrMap(recipe, testArr)
+	assert.Equal(t, nil, err)
+	names, _ := mm.MetricNames()
+	assert.Equal(t, 8, len(names))
+	assert.Equal(t, 1, mm["ch[3]"].Delta)
+	assert.Equal(t, 1, mm["Sensors[1].Temp"].Delta)
+
+	tabulated, errTabulate := mm.TabulateValues([]string{"ch[0]", "ch[3]", "Sensors[1].Temp", "Sensors[0].Hum"}, "\t")
+	assert.Equal(t, nil, errTabulate)
+	assert.Equal(t, "0.00\t2.30\t-3.0\t30.0\n0.10\t2.40\t-3.1\t31.0\n", tabulated)
+}
+
+type Fix struct {
+	Lat, Lon float64
+}
+
+func (p *Fix) SplurtsPiecewises() splurts.PiecewiseFloats {
+	return splurts.PiecewiseFloats{
+		{Name: "Lat", Min: -90, Steps: []splurts.PiecewiseCodingStep{{Size: 0.001, Count: 180000}}},
+		{Name: "Lon", Min: -180, Steps: []splurts.PiecewiseCodingStep{{Size: 0.001, Count: 360000}}},
+	}
+}
+
+func (p *Fix) ToFloats() []float64 { return []float64{p.Lat, p.Lon} }
+
+func (p *Fix) FromFloats(values []float64) error {
+	p.Lat, p.Lon = values[0], values[1]
+	return nil
+}
+
+type FixMeas struct {
+	Pos Fix `messagepack:"position,delta=1"`
+}
+
+func TestMarshalerFields(t *testing.T) {
+	testArr := []FixMeas{{Pos: Fix{Lat: 60.169, Lon: 24.938}}, {Pos: Fix{Lat: 60.170, Lon: 24.940}}}
+	recipe, errRecipe := splurts.GetPiecewisesFromStruct(FixMeas{})
+	assert.Equal(t, nil, errRecipe)
+	mm, err := SplurtsArrToMetricArrMap(recipe, testArr)
+	assert.Equal(t, nil, err)
+	names, _ := mm.MetricNames()
+	assert.ElementsMatch(t, []string{"position.Lat", "position.Lon"}, names)
+	assert.Equal(t, 1, mm["position.Lon"].Delta)
+}
+
+type RelativeSample struct {
+	Start    time.Time `splurts:"epoch,omit" messagepack:"delta=1"`
+	Measured time.Time `splurts:"relative,step=100,max=1h" messagepack:"measured"`
+}
+
+func TestRelativeTime(t *testing.T) {
+	start := time.UnixMilli(1670523401000)
+	testArr := []RelativeSample{
+		{Start: start, Measured: start.Add(time.Second)},
+		{Start: start, Measured: start.Add(2500 * time.Millisecond)},
+	}
+	recipe, errRecipe := splurts.GetPiecewisesFromStruct(RelativeSample{})
+	assert.Equal(t, nil, errRecipe)
+	mm, err := SplurtsArrToMetricArrMap(recipe, testArr)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "Start", mm["measured"].Coding.Relative)
+
+	var buf bytes.Buffer
+	assert.Equal(t, nil, mm.Write(&buf))
+	back, errRead := ReadMetricsArrMap(&buf)
+	assert.Equal(t, nil, errRead)
+	assert.Equal(t, "Start", back["measured"].Coding.Relative)
+
+	values, errValues := back.AbsoluteValues("measured")
+	assert.Equal(t, nil, errValues)
+	assert.Equal(t, []float64{1670523402000, 1670523403500}, values)
+
+	tabulated, errTabulate := back.TabulateValues([]string{"measured"}, ";")
+	assert.Equal(t, nil, errTabulate)
+	assert.Equal(t, "1670523402000\n1670523403500\n", tabulated)
+
+	loop := back["measured"]
+	loop.Coding.Relative = "measured"
+	back["measured"] = loop
+	_, errLoop := back.AbsoluteValues("measured")
+	assert.NotEqual(t, nil, errLoop, "relative to itself")
+}
+
+type RadiationMeas struct {
+	Dose float64 `splurts:"log,min=0.01,max=10000,relstep=1%" messagepack:"dose"`
+}
+
+func TestLogCoding(t *testing.T) {
+	testArr := []RadiationMeas{{Dose: 0.0123}, {Dose: 5000}, {Dose: math.NaN()}, {Dose: 20000}}
+	recipe, errRecipe := splurts.GetPiecewisesFromStruct(RadiationMeas{})
+	assert.Equal(t, nil, errRecipe)
+	mm, err := SplurtsArrToMetricArrMap(recipe, testArr)
+	assert.Equal(t, nil, err)
+
+	var buf bytes.Buffer
+	assert.Equal(t, nil, mm.Write(&buf))
+	back, errRead := ReadMetricsArrMap(&buf)
+	assert.Equal(t, nil, errRead)
+	dose := back["dose"]
+	assert.True(t, dose.Coding.Log)
+
+	values, errValues := dose.AllValues()
+	assert.Equal(t, nil, errValues)
+	assert.InEpsilon(t, 0.0123, values[0], 0.005)
+	assert.InEpsilon(t, 5000, values[1], 0.005)
+	assert.True(t, math.IsNaN(values[2]))
+	assert.True(t, math.IsInf(values[3], 1))
+
+	tabulated, errTabulate := back.TabulateValues([]string{"dose"}, ";")
+	assert.Equal(t, nil, errTabulate)
+	assert.Equal(t, "0.0123\n5011\nNaN\n+Inf\n", tabulated)
+}
+
+type ThermistorMeas struct {
+	Temperature float64 `splurts:"table=100 125|1000 60|2000 25|4000 -40" messagepack:"temp"`
+}
+
+func TestCalibrationTable(t *testing.T) {
+	testArr := []ThermistorMeas{{Temperature: 42.5}, {Temperature: -41}, {Temperature: math.NaN()}, {Temperature: 21.3}}
+	recipe, errRecipe := splurts.GetPiecewisesFromStruct(ThermistorMeas{})
+	assert.Equal(t, nil, errRecipe)
+	mm, err := SplurtsArrToMetricArrMap(recipe, testArr)
+	assert.Equal(t, nil, err)
+
+	var buf bytes.Buffer
+	assert.Equal(t, nil, mm.Write(&buf))
+	back, errRead := ReadMetricsArrMap(&buf)
+	assert.Equal(t, nil, errRead)
+	temp := back["temp"]
+	assert.Equal(t, []MetricBreakpoint{{100, 125}, {1000, 60}, {2000, 25}, {4000, -40}}, temp.Coding.Table)
+
+	values, errValues := temp.AllValues()
+	assert.Equal(t, nil, errValues)
+	assert.Equal(t, 42.5, values[0])
+	assert.True(t, math.IsInf(values[1], -1))
+	assert.True(t, math.IsNaN(values[2]))
+	assert.InDelta(t, 21.3, values[3], 0.02)
+
+	tabulated, errTabulate := back.TabulateValues([]string{"temp"}, ";")
+	assert.Equal(t, nil, errTabulate)
+	assert.Equal(t, "42.50\n-Inf\nNaN\n21.30\n", tabulated)
+}
+
+type ProbeMeas struct {
+	Temperature float64 `splurts:"min=-40,max=85,step=0.5,special=DISCONNECTED,WARMUP" messagepack:"temp"`
+	Dose        float64 `splurts:"min=0.01,max=100,log,relstep=1%,special=SATURATED" messagepack:"dose"`
+}
+
+func TestSpecialCodes(t *testing.T) {
+	recipe, errRecipe := splurts.GetPiecewisesFromStruct(ProbeMeas{})
+	assert.Equal(t, nil, errRecipe)
+	warmup, _ := recipe[0].Special("WARMUP")
+	disconnected, _ := recipe[0].Special("DISCONNECTED")
+	saturated, _ := recipe[1].Special("SATURATED")
+	testArr := []ProbeMeas{{21.5, 1}, {warmup, saturated}, {disconnected, math.NaN()}, {math.Inf(1), 100}}
+	mm, err := SplurtsArrToMetricArrMap(recipe, testArr)
+	assert.Equal(t, nil, err)
+
+	var buf bytes.Buffer
+	assert.Equal(t, nil, mm.Write(&buf))
+	back, errRead := ReadMetricsArrMap(&buf)
+	assert.Equal(t, nil, errRead)
+	temp := back["temp"]
+	assert.Equal(t, []string{"DISCONNECTED", "WARMUP"}, temp.Coding.Specials)
+
+	values, errValues := temp.AllValues()
+	assert.Equal(t, nil, errValues)
+	assert.Equal(t, 21.5, values[0])
+	assert.Equal(t, "WARMUP", recipe[0].SpecialName(values[1]))
+	assert.Equal(t, "DISCONNECTED", recipe[0].SpecialName(values[2]))
+	assert.True(t, math.IsInf(values[3], 1))
+	specials, errSpecials := temp.AllSpecials()
+	assert.Equal(t, nil, errSpecials)
+	assert.Equal(t, []string{"", "WARMUP", "DISCONNECTED", ""}, specials)
+
+	tabulated, errTabulate := back.TabulateValues([]string{"temp", "dose"}, ";")
+	assert.Equal(t, nil, errTabulate)
+	assert.Equal(t, "21.5;1.00\nWARMUP;SATURATED\nDISCONNECTED;NaN\n+Inf;100\n", tabulated)
+}
+
+type MachineMeas struct {
+	State string `splurts:"enum=IDLE:1,RUN:5,ERROR:7" messagepack:"state"`
+	Mode  string `splurts:"unknown=OTHER,enum=AUTO,MANUAL,OTHER:15" messagepack:"mode"`
+}
+
+func TestEnumCodes(t *testing.T) {
+	recipe, errRecipe := splurts.GetPiecewisesFromStruct(MachineMeas{})
+	assert.Equal(t, nil, errRecipe)
+	testArr := []MachineMeas{{"RUN", "AUTO"}, {"ERROR", "SERVICE"}, {"", "MANUAL"}}
+	mm, err := SplurtsArrToMetricArrMap(recipe, testArr)
+	assert.Equal(t, nil, err)
+
+	var buf bytes.Buffer
+	assert.Equal(t, nil, mm.Write(&buf))
+	back, errRead := ReadMetricsArrMap(&buf)
+	assert.Equal(t, nil, errRead)
+	assert.Equal(t, []int64{1, 5, 7}, back["state"].Coding.EnumCodes)
+	assert.Equal(t, "OTHER", back["mode"].Coding.EnumUnknown)
+
+	state := back["state"]
+	values, errValues := state.AllValues()
+	assert.Equal(t, nil, errValues)
+	assert.Equal(t, []float64{5, 7, 0}, values)
+
+	tabulated, errTabulate := back.TabulateValues([]string{"state", "mode"}, ";")
+	assert.Equal(t, nil, errTabulate)
+	assert.Equal(t, "RUN;AUTO\nERROR;OTHER\n;MANUAL\n", tabulated)
+
+	mode := back["mode"]
+	name, errName := mode.EnumName(9)
+	assert.Equal(t, nil, errName)
+	assert.Equal(t, "OTHER", name)
+	_, errName = state.EnumName(3)
+	assert.NotEqual(t, nil, errName)
+}
+
+type HeaterStatus struct {
+	Status uint16   `splurts:"flags=HEATER,FAN,ALARM" messagepack:"status"`
+	Active []string `splurts:"flags=PUMP,VALVE" messagepack:"active"`
+}
+
+func TestFlags(t *testing.T) {
+	recipe, errRecipe := splurts.GetPiecewisesFromStruct(HeaterStatus{})
+	assert.Equal(t, nil, errRecipe)
+	testArr := []HeaterStatus{{0b101, []string{"VALVE"}}, {0, nil}, {0b111, []string{"PUMP", "VALVE"}}}
+	mm, err := SplurtsArrToMetricArrMap(recipe, testArr)
+	assert.Equal(t, nil, err)
+
+	var buf bytes.Buffer
+	assert.Equal(t, nil, mm.Write(&buf))
+	back, errRead := ReadMetricsArrMap(&buf)
+	assert.Equal(t, nil, errRead)
+	status := back["status"]
+	assert.Equal(t, []string{"HEATER", "FAN", "ALARM"}, status.Coding.Flags)
+
+	values, errValues := status.AllValues()
+	assert.Equal(t, nil, errValues)
+	assert.Equal(t, []float64{5, 0, 7}, values)
+
+	tabulated, errTabulate := back.TabulateValues([]string{"status", "active"}, ";")
+	assert.Equal(t, nil, errTabulate)
+	assert.Equal(t, "HEATER|ALARM;VALVE\n;\nHEATER|FAN|ALARM;PUMP|VALVE\n", tabulated)
+}
+
+type PumpMode uint8
+
+const (
+	PUMPOFF PumpMode = iota
+	PUMPAUTO
+	PUMPMANUAL
+)
+
+func (m PumpMode) String() string {
+	return [...]string{"OFF", "AUTO", "MANUAL"}[m]
+}
+
+type PumpMeas struct {
+	Mode  PumpMode `splurts:"" messagepack:"mode"`
+	Alarm int      `splurts:"enum=NONE,LOW,HIGH" messagepack:"alarm"`
+}
+
+func TestIntegerEnums(t *testing.T) {
+	recipe, errRecipe := splurts.GetPiecewisesFromStruct(PumpMeas{})
+	assert.Equal(t, nil, errRecipe)
+	testArr := []PumpMeas{{PUMPAUTO, 0}, {PUMPOFF, 2}, {PUMPMANUAL, 1}}
+	mm, err := SplurtsArrToMetricArrMap(recipe, testArr)
+	assert.Equal(t, nil, err)
+
+	var buf bytes.Buffer
+	assert.Equal(t, nil, mm.Write(&buf))
+	back, errRead := ReadMetricsArrMap(&buf)
+	assert.Equal(t, nil, errRead)
+	assert.Equal(t, []int64{0, 1, 2}, back["mode"].Coding.EnumCodes)
+
+	tabulated, errTabulate := back.TabulateValues([]string{"mode", "alarm"}, ";")
+	assert.Equal(t, nil, errTabulate)
+	assert.Equal(t, "AUTO;NONE\nOFF;HIGH\nMANUAL;LOW\n", tabulated)
+}
+
+type StationMeas struct {
+	Callsign string `splurts:"text=8" messagepack:"call"`
+	Station  string `splurts:"text=10,alphabet=baudot" messagepack:"station"`
+}
+
+func TestTextFields(t *testing.T) {
+	recipe, errRecipe := splurts.GetPiecewisesFromStruct(StationMeas{})
+	assert.Equal(t, nil, errRecipe)
+	testArr := []StationMeas{{"OH2-ABC", "HELSINKI"}, {"", "ESPOO"}, {"N0CALL", "A"}}
+	mm, err := SplurtsArrToMetricArrMap(recipe, testArr)
+	assert.Equal(t, nil, err)
+
+	var buf bytes.Buffer
+	assert.Equal(t, nil, mm.Write(&buf))
+	back, errRead := ReadMetricsArrMap(&buf)
+	assert.Equal(t, nil, errRead)
+	assert.Equal(t, int64(8), back["call"].Coding.TextLength)
+	assert.Equal(t, "baudot", back["station"].Coding.Alphabet)
+
+	tabulated, errTabulate := back.TabulateValues([]string{"call", "station"}, ";")
+	assert.Equal(t, nil, errTabulate)
+	assert.Equal(t, "OH2-ABC;HELSINKI\n;ESPOO\nN0CALL;A\n", tabulated)
+}
+
+type WindMeas struct {
+	Direction float64 `splurts:"circular,min=0,max=360,step=0.5" messagepack:"dir,delta=1"`
+}
+
+func TestCircular(t *testing.T) {
+	recipe, errRecipe := splurts.GetPiecewisesFromStruct(WindMeas{})
+	assert.Equal(t, nil, errRecipe)
+	testArr := []WindMeas{{359}, {359.5}, {0.5}, {1}, {359.5}}
+	mm, err := SplurtsArrToMetricArrMap(recipe, testArr)
+	assert.Equal(t, nil, err)
+	deltas, errDeltas := RLEMessagepackToArr(bytes.NewBuffer(mm["dir"].Data))
+	assert.Equal(t, nil, errDeltas)
+	assert.Equal(t, []int64{718, 1, 2, 1, -3}, deltas, "no jump at wrap")
+
+	var buf bytes.Buffer
+	assert.Equal(t, nil, mm.Write(&buf))
+	back, errRead := ReadMetricsArrMap(&buf)
+	assert.Equal(t, nil, errRead)
+	dir := back["dir"]
+	assert.Equal(t, true, dir.Coding.Circular)
+	values, errValues := dir.AllValues()
+	assert.Equal(t, nil, errValues)
+	assert.Equal(t, []float64{359, 359.5, 0.5, 1, 359.5}, values)
+
+	_, err = SplurtsArrToMetricArrMap(recipe, []WindMeas{{1}, {math.NaN()}})
+	assert.NotEqual(t, nil, err, "circular does not have NaN code")
+}
+
+type AssetMeas struct {
+	Pos     [2]float64 `splurts:"geo,precision=5m,bbox=59 20|70 32" messagepack:"pos,delta=1"`
+	Battery float64    `splurts:"min=0,max=5,step=0.1" messagepack:"bat"`
+}
+
+func TestGeoPosition(t *testing.T) {
+	recipe, errRecipe := splurts.GetPiecewisesFromStruct(AssetMeas{})
+	assert.Equal(t, nil, errRecipe)
+	testArr := []AssetMeas{{[2]float64{60.1699, 24.9384}, 3.7}, {[2]float64{65.0121, 25.4651}, 3.6}}
+	mm, err := SplurtsArrToMetricArrMap(recipe, testArr)
+	assert.Equal(t, nil, err)
+
+	var buf bytes.Buffer
+	assert.Equal(t, nil, mm.Write(&buf))
+	back, errRead := ReadMetricsArrMap(&buf)
+	assert.Equal(t, nil, errRead)
+	assert.Equal(t, "lat", back["pos.Lat"].Coding.Geo)
+	assert.Equal(t, 1, back["pos.Lon"].Delta)
+
+	pairs, errPairs := back.GeoPairs()
+	assert.Equal(t, nil, errPairs)
+	assert.Equal(t, []splurts.GeoPair{{Name: "pos", Lat: "pos.Lat", Lon: "pos.Lon"}}, pairs)
+
+	tabulated, errTabulate := back.TabulateValues([]string{pairs[0].Lat, pairs[0].Lon}, ",")
+	assert.Equal(t, nil, errTabulate)
+	assert.Equal(t, "60.16988,24.93839\n65.01209,25.46511\n", tabulated)
+
+	names, errNames := back.ExportNames()
+	assert.Equal(t, nil, errNames)
+	assert.Equal(t, []string{"bat", "pos"}, names)
+	tabulated, errTabulate = back.TabulateValues(nil, ";")
+	assert.Equal(t, nil, errTabulate)
+	assert.Equal(t, "3.7;60.16988 24.93839\n3.6;65.01209 25.46511\n", tabulated, "position as lat/lon pair")
+}
+
+type BuoyMeas struct {
+	Temperature float64    `splurts:"min=-40,max=85,step=0.5" messagepack:"temp"`
+	Humidity    float64    `splurts:"min=0,max=100,step=1" messagepack:"hum"`
+	Pos         [2]float64 `splurts:"geo,precision=5m,bbox=59 20|70 32" messagepack:"pos"`
+	Battery     float64    `splurts:"min=0,max=5,step=0.1" messagepack:"bat"`
+}
+
+func TestExportNames(t *testing.T) {
+	recipe, errRecipe := splurts.GetPiecewisesFromStruct(BuoyMeas{})
+	assert.Equal(t, nil, errRecipe)
+	mm, err := SplurtsArrToMetricArrMap(recipe, []BuoyMeas{{21.5, 40, [2]float64{60.1699, 24.9384}, 3.7}})
+	assert.Equal(t, nil, err)
+	for i := 0; i < 10; i++ { //Map order changes between iterations
+		names, errNames := mm.ExportNames()
+		assert.Equal(t, nil, errNames)
+		assert.Equal(t, []string{"bat", "hum", "pos", "temp"}, names, "sorted, not in map or struct order")
+		tabulated, errTabulate := mm.TabulateValues(nil, ";")
+		assert.Equal(t, nil, errTabulate)
+		assert.Equal(t, "3.7;40;60.16988 24.93839;21.5\n", tabulated)
+	}
+}
+
+type SpectrumMeas struct {
+	Bins [4]float64 `splurts:"block=8,step=0.01,max=1000" messagepack:"bins"`
+}
+
+func TestBlockFloatNotSupported(t *testing.T) {
+	recipe, errRecipe := splurts.GetPiecewisesFromStruct(SpectrumMeas{})
+	assert.Equal(t, nil, errRecipe)
+	_, err := SplurtsArrToMetricArrMap(recipe, []SpectrumMeas{{[4]float64{1, 2, 3, 400}}})
+	assert.NotEqual(t, nil, err)
+}
+
+type PulseMeas struct {
+	Energy float64 `splurts:"float=16" messagepack:"energy"`
+}
+
+func TestFloatCoded(t *testing.T) {
+	recipe, errRecipe := splurts.GetPiecewisesFromStruct(PulseMeas{})
+	assert.Equal(t, nil, errRecipe)
+	testArr := []PulseMeas{{0.1}, {1234.5}, {0}, {math.Inf(-1)}, {math.NaN()}}
+	mm, err := SplurtsArrToMetricArrMap(recipe, testArr)
+	assert.Equal(t, nil, err)
+
+	var buf bytes.Buffer
+	assert.Equal(t, nil, mm.Write(&buf))
+	back, errRead := ReadMetricsArrMap(&buf)
+	assert.Equal(t, nil, errRead)
+	energy := back["energy"]
+	assert.Equal(t, "e5m10", energy.Coding.Float)
+	assert.Equal(t, 0, len(energy.Steps))
+	assert.Equal(t, 65504.0, energy.Coding.Max)
+
+	v, step, errValue := energy.ValueAndStep(0x3C00)
+	assert.Equal(t, nil, errValue)
+	assert.Equal(t, 1.0, v)
+	assert.Equal(t, 1.0/1024, step)
+
+	strs, errStrings := energy.AllValuesAsString()
+	assert.Equal(t, nil, errStrings)
+	assert.Equal(t, []string{"0.09998", "1234", "0", "-Inf", "NaN"}, strs)
+}
@@ -6,9 +6,139 @@ import (
 )
 
 type MetricCoding struct {
-	Min     float64
-	Max     float64
-	Clamped bool
+	Min      float64
+	Max      float64
+	Clamped  bool
+	Relative string //Values are offsets from this metric, like relative time from epoch
+	Log      bool   //Each step multiplies value by 1+step
+	Table    []MetricBreakpoint
+	Specials []string //Reserved special codes below +inf code
+
+	EnumCodes   []int64 //Explicit enum codes, nil means codes by position starting from 1
+	EnumUnknown string  //Enum name for unknown codes
+
+	Flags []string //Bit flag names, first is lowest bit
+
+	TextLength int64  //Max length of fixed length text, 0 is not text
+	Alphabet   string //Alphabet of text
+
+	Circular bool //Codes wrap around, max is same as min
+
+	Geo string //splurts.GEOLAT or splurts.GEOLON when metric is part of geo position
+
+	Float string //Reduced precision float format like e5m10, empty if not float
+}
+
+// MetricBreakpoint is point of calibration table. Values are interpolated linearly between codes
+type MetricBreakpoint struct {
+	Code  int64
+	Value float64
+}
+
+func readMetricTable(buf io.Reader) ([]MetricBreakpoint, error) {
+	n, err := ReadArr(buf)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]MetricBreakpoint, n)
+	for i := range result {
+		pair, errPair := ReadArr(buf)
+		if errPair != nil {
+			return nil, errPair
+		}
+		if pair != 2 {
+			return nil, fmt.Errorf("table point have %v items, code and value required", pair)
+		}
+		result[i].Code, err = ReadInt(buf)
+		if err != nil {
+			return nil, err
+		}
+		result[i].Value, err = ReadNumber(buf)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func writeMetricTable(w io.Writer, table []MetricBreakpoint) error {
+	err := WriteArray(w, uint32(len(table)))
+	if err != nil {
+		return err
+	}
+	for _, point := range table {
+		err = WriteArray(w, 2)
+		if err != nil {
+			return err
+		}
+		err = WriteInt(w, point.Code)
+		if err != nil {
+			return err
+		}
+		err = writeFloat64(w, point.Value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readStringArr(buf io.Reader) ([]string, error) {
+	n, err := ReadArr(buf)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, n)
+	for i := range result {
+		result[i], err = ReadString(buf)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func writeStringArr(w io.Writer, arr []string) error {
+	err := WriteArray(w, uint32(len(arr)))
+	if err != nil {
+		return err
+	}
+	for _, s := range arr {
+		err = WriteString(w, s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readIntArr(buf io.Reader) ([]int64, error) {
+	n, err := ReadArr(buf)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]int64, n)
+	for i := range result {
+		result[i], err = ReadInt(buf)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func writeIntArr(w io.Writer, arr []int64) error {
+	err := WriteArray(w, uint32(len(arr)))
+	if err != nil {
+		return err
+	}
+	for _, i := range arr {
+		err = WriteInt(w, i)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func ReadMetricCoding(buf io.Reader) (MetricCoding, error) {
@@ -30,6 +160,30 @@ func ReadMetricCoding(buf io.Reader) (MetricCoding, error) {
 			result.Max, readErr = ReadNumber(buf)
 		case MPNAME_CODING_CLAMPED:
 			result.Clamped, readErr = ReadBool(buf)
+		case MPNAME_CODING_RELATIVE:
+			result.Relative, readErr = ReadString(buf)
+		case MPNAME_CODING_LOG:
+			result.Log, readErr = ReadBool(buf)
+		case MPNAME_CODING_TABLE:
+			result.Table, readErr = readMetricTable(buf)
+		case MPNAME_CODING_SPECIAL:
+			result.Specials, readErr = readStringArr(buf)
+		case MPNAME_CODING_ENUMCODES:
+			result.EnumCodes, readErr = readIntArr(buf)
+		case MPNAME_CODING_ENUMUNKNOWN:
+			result.EnumUnknown, readErr = ReadString(buf)
+		case MPNAME_CODING_FLAGS:
+			result.Flags, readErr = readStringArr(buf)
+		case MPNAME_CODING_TEXT:
+			result.TextLength, readErr = ReadInt(buf)
+		case MPNAME_CODING_ALPHABET:
+			result.Alphabet, readErr = ReadString(buf)
+		case MPNAME_CODING_CIRCULAR:
+			result.Circular, readErr = ReadBool(buf)
+		case MPNAME_CODING_GEO:
+			result.Geo, readErr = ReadString(buf)
+		case MPNAME_CODING_FLOAT:
+			result.Float, readErr = ReadString(buf)
 		}
 		if readErr != nil {
 			return result, readErr
@@ -39,10 +193,162 @@ func ReadMetricCoding(buf io.Reader) (MetricCoding, error) {
 }
 
 func (p *MetricCoding) Write(w io.Writer) error {
-	err := WriteFixmap(w, 3)
+	itemCount := uint32(3)
+	if p.Relative != "" {
+		itemCount++
+	}
+	if p.Log {
+		itemCount++
+	}
+	if p.Circular {
+		itemCount++
+	}
+	if p.Geo != "" {
+		itemCount++
+	}
+	if p.Float != "" {
+		itemCount++
+	}
+	if 0 < len(p.Table) {
+		itemCount++
+	}
+	if 0 < len(p.Specials) {
+		itemCount++
+	}
+	if 0 < len(p.EnumCodes) {
+		itemCount++
+	}
+	if p.EnumUnknown != "" {
+		itemCount++
+	}
+	if 0 < len(p.Flags) {
+		itemCount++
+	}
+	if 0 < p.TextLength {
+		itemCount += 2
+	}
+	err := WriteFixmap(w, itemCount)
 	if err != nil {
 		return err
 	}
+	if p.Relative != "" {
+		err = WriteString(w, MPNAME_CODING_RELATIVE)
+		if err != nil {
+			return err
+		}
+		err = WriteString(w, p.Relative)
+		if err != nil {
+			return err
+		}
+	}
+	if p.Log {
+		err = WriteString(w, MPNAME_CODING_LOG)
+		if err != nil {
+			return err
+		}
+		err = WriteBool(w, p.Log)
+		if err != nil {
+			return err
+		}
+	}
+	if p.Circular {
+		err = WriteString(w, MPNAME_CODING_CIRCULAR)
+		if err != nil {
+			return err
+		}
+		err = WriteBool(w, p.Circular)
+		if err != nil {
+			return err
+		}
+	}
+	if p.Geo != "" {
+		err = WriteString(w, MPNAME_CODING_GEO)
+		if err != nil {
+			return err
+		}
+		err = WriteString(w, p.Geo)
+		if err != nil {
+			return err
+		}
+	}
+	if p.Float != "" {
+		err = WriteString(w, MPNAME_CODING_FLOAT)
+		if err != nil {
+			return err
+		}
+		err = WriteString(w, p.Float)
+		if err != nil {
+			return err
+		}
+	}
+	if 0 < len(p.Table) {
+		err = WriteString(w, MPNAME_CODING_TABLE)
+		if err != nil {
+			return err
+		}
+		err = writeMetricTable(w, p.Table)
+		if err != nil {
+			return err
+		}
+	}
+	if 0 < len(p.Specials) {
+		err = WriteString(w, MPNAME_CODING_SPECIAL)
+		if err != nil {
+			return err
+		}
+		err = writeStringArr(w, p.Specials)
+		if err != nil {
+			return err
+		}
+	}
+	if 0 < len(p.EnumCodes) {
+		err = WriteString(w, MPNAME_CODING_ENUMCODES)
+		if err != nil {
+			return err
+		}
+		err = writeIntArr(w, p.EnumCodes)
+		if err != nil {
+			return err
+		}
+	}
+	if p.EnumUnknown != "" {
+		err = WriteString(w, MPNAME_CODING_ENUMUNKNOWN)
+		if err != nil {
+			return err
+		}
+		err = WriteString(w, p.EnumUnknown)
+		if err != nil {
+			return err
+		}
+	}
+	if 0 < len(p.Flags) {
+		err = WriteString(w, MPNAME_CODING_FLAGS)
+		if err != nil {
+			return err
+		}
+		err = writeStringArr(w, p.Flags)
+		if err != nil {
+			return err
+		}
+	}
+	if 0 < p.TextLength {
+		err = WriteString(w, MPNAME_CODING_TEXT)
+		if err != nil {
+			return err
+		}
+		err = WriteInt(w, p.TextLength)
+		if err != nil {
+			return err
+		}
+		err = WriteString(w, MPNAME_CODING_ALPHABET)
+		if err != nil {
+			return err
+		}
+		err = WriteString(w, p.Alphabet)
+		if err != nil {
+			return err
+		}
+	}
 
 	err = WriteString(w, MPNAME_CODING_MIN)
 	if err != nil {
@@ -4,6 +4,10 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"math/bits"
+	"strings"
+
+	"github.com/hjkoskel/splurts"
 )
 
 // Like recipe... create once. Update data..write..read...search
@@ -61,7 +65,7 @@ func (p *MetricArr) Write(w io.Writer) error {
 		if e != nil {
 			return e
 		}
-		if len(p.Steps) == 0 {
+		if len(p.Steps) == 0 && len(p.Coding.Table) == 0 && p.Coding.Float == "" {
 			return fmt.Errorf("no steps defined")
 		}
 		e = WriteArray(w, uint32(len(p.Steps)))
@@ -189,19 +193,36 @@ func ReadMetricArr(buf io.Reader) (MetricArr, error) {
 
 // ValueAndStepsize, gets value and stepsize at that local part of curve (used for calculating required decimals)
 func (p *MetricArr) ValueAndStep(reg int64) (float64, float64, error) {
-	if len(p.Steps) == 0 {
+	if p.Coding.Float != "" {
+		return p.floatValueAndStep(reg)
+	}
+	if len(p.Steps) == 0 && len(p.Coding.Table) == 0 {
 		return float64(reg), 1, nil
 	}
+	if p.Coding.Circular {
+		reg = wrapModulo(reg, p.modulo())
+	}
 	counter := int64(0)
 	total := float64(0)
 	targetIndex := reg
 	if !p.Coding.Clamped {
-		if reg == 0 {
+		if reg == p.negInfCode() {
 			return math.Inf(-1), 0, nil
 		}
-		targetIndex--
+		if index, isSpecial := p.specialIndex(reg); isSpecial {
+			return splurts.SpecialValue(index), 0, nil
+		}
+		if len(p.Coding.Table) == 0 { //Table codes are codes on wire
+			targetIndex--
+		}
 	}
 
+	if p.Coding.Log {
+		return p.logValueAndStep(reg, targetIndex)
+	}
+	if 0 < len(p.Coding.Table) {
+		return p.tableValueAndStep(reg, targetIndex)
+	}
 	for _, step := range p.Steps {
 		if targetIndex < counter+step.Count {
 			return p.Coding.Min + total + float64(targetIndex-counter)*step.Step, step.Step, nil
@@ -209,17 +230,184 @@ func (p *MetricArr) ValueAndStep(reg int64) (float64, float64, error) {
 		counter += step.Count
 		total += float64(step.Count) * step.Step
 	}
+	if targetIndex == counter { //Last point of coding
+		return p.Coding.Min + total, p.Steps[len(p.Steps)-1].Step, nil
+	}
 	if p.Coding.Clamped {
 		return 0, 0, fmt.Errorf("out of range, clamped reg=%v", reg)
 	}
-	if reg == counter {
+	if reg == p.maxCode()-1 {
 		return math.Inf(1), 0, nil
 	}
 	return math.NaN(), 0, nil
 }
 
+// floatValueAndStep is ValueAndStep for reduced precision float, code is float bits. Step of zero is 1 for printing without decimals
+func (p *MetricArr) floatValueAndStep(reg int64) (float64, float64, error) {
+	exponent, mantissa, errFormat := splurts.ParseFloatFormat(p.Coding.Float)
+	if errFormat != nil {
+		return 0, 0, errFormat
+	}
+	coding := splurts.PiecewiseCoding{Name: "float", FloatExponent: exponent, FloatMantissa: mantissa}
+	v := coding.ScaleToFloat(uint64(reg))
+	switch {
+	case math.IsNaN(v) || math.IsInf(v, 0):
+		return v, 0, nil
+	case v == 0:
+		return v, 1, nil
+	}
+	return v, coding.LocalStep(v), nil
+}
+
+// logValueAndStep is ValueAndStep for log coding. Step is local absolute step at value
+func (p *MetricArr) logValueAndStep(reg int64, targetIndex int64) (float64, float64, error) {
+	counter := int64(0)
+	total := p.Coding.Min
+	for _, step := range p.Steps {
+		if targetIndex < counter+step.Count {
+			v := total * math.Pow(1+step.Step, float64(targetIndex-counter))
+			return v, v * step.Step, nil
+		}
+		counter += step.Count
+		total *= math.Pow(1+step.Step, float64(step.Count))
+	}
+	if targetIndex == counter { //Last point of coding
+		return total, total * p.Steps[len(p.Steps)-1].Step, nil
+	}
+	if p.Coding.Clamped {
+		return 0, 0, fmt.Errorf("out of range, clamped reg=%v", reg)
+	}
+	if reg == p.maxCode()-1 {
+		return math.Inf(1), 0, nil
+	}
+	return math.NaN(), 0, nil
+}
+
+// negInfCode is code of -inf when coding is not clamped. Calibration table have it just above last table code
+func (p *MetricArr) negInfCode() int64 {
+	if 0 < len(p.Coding.Table) {
+		return p.Coding.Table[len(p.Coding.Table)-1].Code + 1
+	}
+	return 0
+}
+
+// tableValueAndStep is ValueAndStep for calibration table. Step is value change per code on that segment
+func (p *MetricArr) tableValueAndStep(reg int64, targetIndex int64) (float64, float64, error) {
+	table := p.Coding.Table
+	last := table[len(table)-1].Code
+	if !p.Coding.Clamped && last < targetIndex {
+		maxCode := p.maxCode()
+		if reg == maxCode-1 {
+			return math.Inf(1), 0, nil
+		}
+		if reg == maxCode {
+			return math.NaN(), 0, nil
+		}
+	}
+	if targetIndex <= table[0].Code {
+		return table[0].Value, math.Abs((table[1].Value - table[0].Value) / float64(table[1].Code-table[0].Code)), nil
+	}
+	for i := 1; i < len(table); i++ {
+		a, b := table[i-1], table[i]
+		if targetIndex <= b.Code {
+			slope := (b.Value - a.Value) / float64(b.Code-a.Code)
+			return a.Value + float64(targetIndex-a.Code)*slope, math.Abs(slope), nil
+		}
+	}
+	if p.Coding.Clamped {
+		return 0, 0, fmt.Errorf("out of range, clamped reg=%v", reg)
+	}
+	return math.NaN(), 0, nil
+}
+
+// EnumName name of enum code. Code 0 is empty if no enum have code 0, unknown codes are EnumUnknown of coding
+func (p *MetricArr) EnumName(reg int64) (string, error) {
+	for i, name := range p.Enums {
+		code := int64(i) + 1
+		if i < len(p.Coding.EnumCodes) {
+			code = p.Coding.EnumCodes[i]
+		}
+		if code == reg {
+			return name, nil
+		}
+	}
+	if reg == 0 {
+		return "", nil
+	}
+	if p.Coding.EnumUnknown != "" {
+		return p.Coding.EnumUnknown, nil
+	}
+	return "", fmt.Errorf("out of range enum reg=%v got %v enums", reg, len(p.Enums))
+}
+
+// TextString unpacks fixed length text, same as on splurts
+func (p *MetricArr) TextString(reg int64) (string, error) {
+	if reg < 0 {
+		return "", fmt.Errorf("text reg=%v is negative", reg)
+	}
+	coding := splurts.PiecewiseCoding{Name: "text", TextLength: int(p.Coding.TextLength), Alphabet: p.Coding.Alphabet}
+	return coding.TextString(uint64(reg))
+}
+
+// FlagsString names of set flags separated with |, same as on splurts
+func (p *MetricArr) FlagsString(reg int64) (string, error) {
+	if reg < 0 || reg>>uint(len(p.Coding.Flags)) != 0 {
+		return "", fmt.Errorf("flags reg=%v have bits outside of %v flags", reg, len(p.Coding.Flags))
+	}
+	names := []string{}
+	for i, flag := range p.Coding.Flags {
+		if reg&(1<<uint(i)) != 0 {
+			names = append(names, flag)
+		}
+	}
+	return strings.Join(names, splurts.FLAGSSEPARATOR), nil
+}
+
+// maxCode highest code of coding that is not clamped. Same as on splurts, NaN, -inf, +inf and special codes are extra codes
+func (p *MetricArr) maxCode() int64 {
+	codes := p.TotalStepCount() + 3
+	if 0 < len(p.Coding.Specials) {
+		codes += int64(len(p.Coding.Specials)) + 1 //Highest value code must not hit special code
+	}
+	return int64(1)<<uint(bits.Len64(uint64(codes-1))) - 1
+}
+
+// specialIndex index of reserved special code. First special code is just below +inf code
+func (p *MetricArr) specialIndex(reg int64) (int, bool) {
+	n := int64(len(p.Coding.Specials))
+	if p.Coding.Clamped || n == 0 {
+		return 0, false
+	}
+	top := p.maxCode() - 2
+	if top < reg || reg <= top-n {
+		return 0, false
+	}
+	return int(top - reg), true
+}
+
+// SpecialName name of reserved special code, empty when code is not special
+func (p *MetricArr) SpecialName(reg int64) string {
+	if index, isSpecial := p.specialIndex(reg); isSpecial {
+		return p.Coding.Specials[index]
+	}
+	return ""
+}
+
+// AllSpecials names of special codes, empty when value is not special code. Names are read from codes, not from NaN payload
+func (p *MetricArr) AllSpecials() ([]string, error) {
+	regarr, errArr := p.Data.ToArrModulo(p.Delta, p.modulo())
+	if errArr != nil {
+		return nil, fmt.Errorf("toArr: %v", errArr.Error())
+	}
+	result := make([]string, len(regarr))
+	for i, reg := range regarr {
+		result[i] = p.SpecialName(reg)
+	}
+	return result, nil
+}
+
 func (p *MetricArr) AllValues() ([]float64, error) { //Crude way to just dump... start with this later optimized functions
-	regarr, errArr := p.Data.ToArr(p.Delta)
+	regarr, errArr := p.Data.ToArrModulo(p.Delta, p.modulo())
 	if errArr != nil {
 		return nil, errArr
 	}
@@ -235,7 +423,18 @@ func (p *MetricArr) AllValues() ([]float64, error) { //Crude way to just dump...
 	return result, nil
 }
 
+// modulo of circular codes for delta coding, 0 when not circular
+func (p *MetricArr) modulo() int64 {
+	if !p.Coding.Circular {
+		return 0
+	}
+	return p.TotalStepCount()
+}
+
 func (p *MetricArr) TotalStepCount() int64 {
+	if 0 < len(p.Coding.Table) {
+		return p.Coding.Table[len(p.Coding.Table)-1].Code + 1
+	}
 	result := int64(0)
 	for _, step := range p.Steps {
 		result += int64(step.Count)
@@ -245,21 +444,37 @@ func (p *MetricArr) TotalStepCount() int64 {
 
 // for text based protocols, json, csv files
 func (p *MetricArr) AllValuesAsString() ([]string, error) {
-	regarr, errArr := p.Data.ToArr(p.Delta)
+	regarr, errArr := p.Data.ToArrModulo(p.Delta, p.modulo())
 	if errArr != nil {
 		return nil, fmt.Errorf("toArr: %v", errArr.Error())
 	}
 	result := make([]string, len(regarr))
 	if 0 < len(p.Enums) {
 		for i, reg := range regarr {
-			if reg == 0 {
-				result[i] = ""
-			} else {
-				if reg-1 < int64(len(p.Enums)) {
-					result[i] = p.Enums[reg-1]
-				} else {
-					return nil, fmt.Errorf("out of range enum reg=%v got %v enums", reg, len(p.Enums))
-				}
+			var errEnum error
+			result[i], errEnum = p.EnumName(reg)
+			if errEnum != nil {
+				return nil, errEnum
+			}
+		}
+		return result, nil
+	}
+	if 0 < len(p.Coding.Flags) {
+		for i, reg := range regarr {
+			var errFlags error
+			result[i], errFlags = p.FlagsString(reg)
+			if errFlags != nil {
+				return nil, errFlags
+			}
+		}
+		return result, nil
+	}
+	if 0 < p.Coding.TextLength {
+		for i, reg := range regarr {
+			var errText error
+			result[i], errText = p.TextString(reg)
+			if errText != nil {
+				return nil, errText
 			}
 		}
 		return result, nil
@@ -269,7 +484,19 @@ func (p *MetricArr) AllValuesAsString() ([]string, error) {
 		if err != nil {
 			return nil, err
 		}
-		formatstring := fmt.Sprintf("%%.%vf", int(math.Ceil(math.Abs(math.Log10(step)))))
+		if step == 0 { //NaN, infinities and special codes
+			if name := p.SpecialName(reg); name != "" {
+				result[i] = name
+				continue
+			}
+			result[i] = fmt.Sprint(f)
+			continue
+		}
+		decimals := int(math.Ceil(math.Abs(math.Log10(step))))
+		if (p.Coding.Log || p.Coding.Float != "") && 1 < step { //Local step of log and float coding grows with value
+			decimals = 0
+		}
+		formatstring := fmt.Sprintf("%%.%vf", decimals)
 		result[i] = fmt.Sprintf(formatstring, f)
 	}
 	return result, nil
@@ -8,6 +8,8 @@ package messagepack
 import (
 	"fmt"
 	"io"
+	"math"
+	"sort"
 	"strings"
 
 	"github.com/hjkoskel/splurts"
@@ -25,14 +27,68 @@ func (p *MetricArrMap) MetricNames() ([]string, error) {
 	return result, nil
 }
 
+// ExportNames sorted names of columns on exports. Latitude and longitude of position are one column named like position
+func (p *MetricArrMap) ExportNames() ([]string, error) {
+	names, errNames := p.MetricNames()
+	if errNames != nil {
+		return nil, errNames
+	}
+	pairs, errPairs := p.GeoPairs()
+	if errPairs != nil {
+		return nil, errPairs
+	}
+	result := []string{}
+	for _, name := range names {
+		paired := false
+		for _, pair := range pairs {
+			paired = paired || name == pair.Lat || name == pair.Lon
+		}
+		if !paired {
+			result = append(result, name)
+		}
+	}
+	for _, pair := range pairs {
+		result = append(result, pair.Name)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// geoPairAsString position values as lat/lon pairs like "60.16988 24.93839"
+func (p *MetricArrMap) geoPairAsString(pair splurts.GeoPair) ([]string, error) {
+	ma := map[string]MetricArr(*p)
+	lat, lon := ma[pair.Lat], ma[pair.Lon]
+	latStrings, errLat := lat.AllValuesAsString()
+	if errLat != nil {
+		return nil, errLat
+	}
+	lonStrings, errLon := lon.AllValuesAsString()
+	if errLon != nil {
+		return nil, errLon
+	}
+	if len(latStrings) != len(lonStrings) {
+		return nil, fmt.Errorf("position %s have %v latitudes and %v longitudes", pair.Name, len(latStrings), len(lonStrings))
+	}
+	result := make([]string, len(latStrings))
+	for i := range latStrings {
+		result[i] = splurts.GeoPairString(latStrings[i], lonStrings[i])
+	}
+	return result, nil
+}
+
+// TabulateValues writes columns of metrics. Position name like pos gives lat/lon pairs. Empty colNames are all ExportNames
 func (p *MetricArrMap) TabulateValues(colNames []string, separator string) (string, error) {
 	if len(colNames) == 0 || colNames == nil {
 		var errNames error
-		colNames, errNames = p.MetricNames()
+		colNames, errNames = p.ExportNames()
 		if errNames != nil {
 			return "", errNames
 		}
 	}
+	pairs, errPairs := p.GeoPairs()
+	if errPairs != nil {
+		return "", errPairs
+	}
 	if len(colNames) == 0 {
 		return "", nil
 	}
@@ -44,10 +100,20 @@ func (p *MetricArrMap) TabulateValues(colNames []string, separator string) (stri
 	for _, name := range colNames {
 		arr, haz := ma[name]
 		if !haz {
-			return "", fmt.Errorf("column %s not found", name)
+			for _, pair := range pairs {
+				if pair.Name == name {
+					resultData[name], stringConvErr = p.geoPairAsString(pair)
+					haz = true
+				}
+			}
+			if !haz {
+				return "", fmt.Errorf("column %s not found", name)
+			}
+		} else if arr.Coding.Relative != "" {
+			resultData[name], stringConvErr = p.absoluteValuesAsString(name)
+		} else {
+			resultData[name], stringConvErr = arr.AllValuesAsString()
 		}
-
-		resultData[name], stringConvErr = arr.AllValuesAsString()
 		if stringConvErr != nil {
 			return "", fmt.Errorf("error converting %v err=%v", name, stringConvErr.Error())
 		}
@@ -73,6 +139,19 @@ func (p *MetricArrMap) TabulateValues(colNames []string, separator string) (stri
 	return sb.String(), nil
 }
 
+// absoluteValuesAsString relative times are milliseconds, so no decimals
+func (p *MetricArrMap) absoluteValuesAsString(name string) ([]string, error) {
+	values, err := p.AbsoluteValues(name)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, len(values))
+	for i, v := range values {
+		result[i] = fmt.Sprintf("%.0f", v)
+	}
+	return result, nil
+}
+
 func ReadMetricsArrMap(buf io.Reader) (MetricArrMap, error) {
 	nMetrics, errNmetrics := ReadFixmap(buf)
 	if errNmetrics != nil {
@@ -119,27 +198,45 @@ func SplurtsArrToMetricArrMap(pw splurts.PiecewiseFloats, input interface{}) (Me
 		return nil, errmap
 	}
 
-	tagsmap, errnamemap := getMessagepackTagString(input)
+	tagsmap, errnamemap := getMessagepackTags(input)
 	if errnamemap != nil {
 		return nil, errnamemap
 	}
 
 	result := make(map[string]MetricArr)
+	metricNames := make(map[string]string) //splurts name to metric name, for linking relative metrics
 	for _, p := range pw {
-		if p.Omit || p.ConstDefined { //skip omits and consts
+		if (p.Omit && !p.Epoch) || p.ConstDefined { //skip omits and consts. Epoch is needed for rebuilding relative times
 			continue
 		}
+		p.Omit = false //Omitted epoch is coded here as any other metric
+
+		if p.Block != nil { //Element step depends on exponent of each record
+			return nil, fmt.Errorf("%s is block floating point, not supported on messagepack", p.Name)
+		}
 
 		arr, haz := valmap[p.Name]
 		if !haz {
 			return nil, fmt.Errorf("name %s not found", p.Name)
 		}
+		for _, f := range arr {
+			if p.Circular && (math.IsNaN(f) || math.IsInf(f, 0)) {
+				return nil, fmt.Errorf("circular %s does not have code for %v", p.Name, f)
+			}
+		}
 
 		tag := tagsmap[p.Name]
-		packdirect, errDirective := parseDirectives(tag, p.Name)
+		packdirect, errDirective := parseDirectives(tag.Tag, p.Name)
 		if errDirective != nil {
 			return result, errDirective
 		}
+		if packdirect.Name != p.Name {
+			packdirect.Name = tag.rename(packdirect.Name)
+		}
+		if _, duplicate := result[packdirect.Name]; duplicate {
+			return result, fmt.Errorf("duplicate metric name %s", packdirect.Name)
+		}
+		metricNames[p.Name] = packdirect.Name
 
 		entryMeta := MetricMeta{
 			Unit:        p.Meta.Unit,
@@ -160,18 +257,108 @@ func SplurtsArrToMetricArrMap(pw splurts.PiecewiseFloats, input interface{}) (Me
 		entry := MetricArr{
 			Meta:   entryMeta,
 			Enums:  p.Enums,
-			Coding: MetricCoding{Min: p.Min, Max: p.Max(), Clamped: p.Clamped},
+			Coding: MetricCoding{Min: p.Min, Max: p.Max(), Clamped: p.Clamped, Log: p.Log, Table: metricTable(p.Table), Specials: p.Specials, EnumCodes: enumCodes(p.EnumCodes), EnumUnknown: p.EnumUnknown, Flags: p.Flags, TextLength: int64(p.TextLength), Alphabet: p.Alphabet, Circular: p.Circular, Geo: p.Geo, Float: p.FloatFormat()},
 			Steps:  entrySteps,
 			Delta:  int(packdirect.Delta),
 		}
 
 		var dataConvErr error
 		//TODO int64 register values required!
-		entry.Data, dataConvErr = CreateDeltaRLEVec(p.ScaleToIntArr(arr), entry.Delta, int(packdirect.Rle))
+		entry.Data, dataConvErr = CreateDeltaRLEVecModulo(p.ScaleToIntArr(arr), entry.Delta, int(packdirect.Rle), entry.modulo())
 		if dataConvErr != nil {
 			return result, dataConvErr
 		}
 		result[packdirect.Name] = entry
 	}
+	for _, p := range pw {
+		if p.RelativeTo == "" {
+			continue
+		}
+		entry, haz := result[metricNames[p.Name]]
+		if !haz {
+			continue
+		}
+		entry.Coding.Relative, haz = metricNames[p.RelativeTo]
+		if !haz {
+			return result, fmt.Errorf("epoch %s of relative metric %s not found", p.RelativeTo, p.Name)
+		}
+		result[metricNames[p.Name]] = entry
+	}
+	return result, nil
+}
+
+func enumCodes(codes []uint64) []int64 {
+	if len(codes) == 0 {
+		return nil
+	}
+	result := make([]int64, len(codes))
+	for i, code := range codes {
+		result[i] = int64(code)
+	}
+	return result
+}
+
+func metricTable(table []splurts.CalibrationPoint) []MetricBreakpoint {
+	if len(table) == 0 {
+		return nil
+	}
+	result := make([]MetricBreakpoint, len(table))
+	for i, point := range table {
+		result[i] = MetricBreakpoint{Code: int64(point.Code), Value: point.Value}
+	}
+	return result
+}
+
+// AbsoluteValues gets values of metric. Relative metric values are added to values of metric they are relative to.
+// Base metric can not be relative
+func (p *MetricArrMap) AbsoluteValues(name string) ([]float64, error) {
+	ma := map[string]MetricArr(*p)
+	arr, haz := ma[name]
+	if !haz {
+		return nil, fmt.Errorf("metric %s not found", name)
+	}
+	result, errValues := arr.AllValues()
+	if errValues != nil || arr.Coding.Relative == "" {
+		return result, errValues
+	}
+	baseArr, hazBase := ma[arr.Coding.Relative]
+	if !hazBase {
+		return nil, fmt.Errorf("base %s of metric %s not found", arr.Coding.Relative, name)
+	}
+	if baseArr.Coding.Relative != "" { //Only one level, also prevents loops
+		return nil, fmt.Errorf("base %s of metric %s is relative to %s", arr.Coding.Relative, name, baseArr.Coding.Relative)
+	}
+	base, errBase := baseArr.AllValues()
+	if errBase != nil {
+		return nil, fmt.Errorf("base of %s err=%v", name, errBase.Error())
+	}
+	if len(base) != len(result) {
+		return nil, fmt.Errorf("metric %s have %v values but base %s have %v", name, len(result), arr.Coding.Relative, len(base))
+	}
+	for i := range result {
+		result[i] += base[i]
+	}
+	return result, nil
+}
+
+// GeoPairs lists latitude and longitude metrics of geo positions, for exporting positions as pairs
+func (p *MetricArrMap) GeoPairs() ([]splurts.GeoPair, error) {
+	names, errNames := p.MetricNames()
+	if errNames != nil {
+		return nil, errNames
+	}
+	sort.Strings(names)
+	result := []splurts.GeoPair{}
+	for _, name := range names {
+		if (*p)[name].Coding.Geo != splurts.GEOLAT {
+			continue
+		}
+		base := strings.TrimSuffix(name, splurts.GeoName("", splurts.GEOLAT))
+		lon := splurts.GeoName(base, splurts.GEOLON)
+		if (*p)[lon].Coding.Geo != splurts.GEOLON {
+			return nil, fmt.Errorf("latitude %v does not have longitude %v", name, lon)
+		}
+		result = append(result, splurts.GeoPair{Name: base, Lat: name, Lon: lon})
+	}
 	return result, nil
 }
@@ -0,0 +1,165 @@
+/*
+Reduced precision floats for values with unknown range. Coded like IEEE 754: sign, biased exponent and mantissa without hidden bit.
+Highest exponent is ±Inf and NaN, lowest exponent is subnormal. Rounding is to nearest even, overflow is ±Inf.
+Minifloats like e4m3 follow same rules, so they have Inf and NaN codes unlike e4m3fn of OCP FP8
+*/
+
+package splurts
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	FLOATHALF     = "16"   //IEEE 754 half precision, e5m10
+	FLOATBFLOAT16 = "bf16" //bfloat16, e8m7. Same range as float32
+	FLOATSINGLE   = "32"   //IEEE 754 single precision, e8m23
+)
+
+var floatFormats = map[string][2]int{ //Exponent and mantissa bits of named formats
+	FLOATHALF:     {5, 10},
+	FLOATBFLOAT16: {8, 7},
+	FLOATSINGLE:   {8, 23},
+}
+
+// ParseFloatFormat parses 16, bf16, 32 or minifloat format like e4m3 to exponent and mantissa bits
+func ParseFloatFormat(s string) (int, int, error) {
+	if bits, haz := floatFormats[s]; haz {
+		return bits[0], bits[1], nil
+	}
+	em := strings.Split(strings.TrimPrefix(s, "e"), "m")
+	if !strings.HasPrefix(s, "e") || len(em) != 2 {
+		return 0, 0, fmt.Errorf("invalid float format %v, use %v, %v, %v or like e4m3", s, FLOATHALF, FLOATBFLOAT16, FLOATSINGLE)
+	}
+	exponent, errExponent := strconv.Atoi(em[0])
+	mantissa, errMantissa := strconv.Atoi(em[1])
+	if errExponent != nil || errMantissa != nil {
+		return 0, 0, fmt.Errorf("invalid float format %v", s)
+	}
+	return exponent, mantissa, floatBitsIsInvalid(exponent, mantissa)
+}
+
+// FloatFormat format of float coding like e5m10, empty if coding is not float
+func (p *PiecewiseCoding) FloatFormat() string {
+	if !p.isFloat() {
+		return ""
+	}
+	return fmt.Sprintf("e%vm%v", p.FloatExponent, p.FloatMantissa)
+}
+
+func floatBitsIsInvalid(exponent int, mantissa int) error {
+	if exponent < 2 || 11 < exponent || mantissa < 1 || 52 < mantissa {
+		return fmt.Errorf("float must have 2..11 exponent bits and 1..52 mantissa bits, got e%vm%v", exponent, mantissa)
+	}
+	return nil
+}
+
+func (p *PiecewiseCoding) isFloat() bool {
+	return 0 < p.FloatExponent
+}
+
+func (p *PiecewiseCoding) floatBias() int {
+	return 1<<uint(p.FloatExponent-1) - 1
+}
+
+// floatMax largest finite value
+func (p *PiecewiseCoding) floatMax() float64 {
+	maxExponent := 1<<uint(p.FloatExponent) - 2 - p.floatBias()
+	return math.Ldexp(2-math.Ldexp(1, -p.FloatMantissa), maxExponent)
+}
+
+// floatStep distance to next code at value f. Smallest step is on subnormals
+func (p *PiecewiseCoding) floatStep(f float64) float64 {
+	_, exp := math.Frexp(math.Min(math.Abs(f), p.floatMax()))
+	minExponent := 1 - p.floatBias()
+	if exp-1 < minExponent {
+		exp = minExponent + 1
+	}
+	return math.Ldexp(1, exp-1-p.FloatMantissa)
+}
+
+func (p *PiecewiseCoding) scaleFloatToUint(f float64) uint64 {
+	sign := uint64(0)
+	if math.Signbit(f) {
+		sign = 1 << uint(p.FloatExponent+p.FloatMantissa)
+	}
+	infCode := uint64(1<<uint(p.FloatExponent)-1) << uint(p.FloatMantissa)
+	switch {
+	case math.IsNaN(f):
+		return infCode | 1<<uint(p.FloatMantissa-1) //Quiet NaN
+	case math.IsInf(f, 0):
+		return sign | infCode
+	case f == 0:
+		return sign
+	}
+	a := math.Abs(f)
+	_, exp := math.Frexp(a)
+	exponent := exp - 1 //a is 1.m*2^exponent
+	minExponent := 1 - p.floatBias()
+	if exponent < minExponent { //Subnormal, mantissa rounds up to smallest normal by carry
+		return sign | uint64(math.RoundToEven(math.Ldexp(a, p.FloatMantissa-minExponent)))
+	}
+	m := uint64(math.RoundToEven(math.Ldexp(a, p.FloatMantissa-exponent))) //With hidden bit, carry goes to exponent
+	code := uint64(exponent+p.floatBias()-1)<<uint(p.FloatMantissa) + m
+	if infCode < code {
+		code = infCode
+	}
+	return sign | code
+}
+
+func (p *PiecewiseCoding) floatToFloat(v uint64) float64 {
+	mantissaMask := uint64(1)<<uint(p.FloatMantissa) - 1
+	m := v & mantissaMask
+	biased := int(v>>uint(p.FloatMantissa)) & (1<<uint(p.FloatExponent) - 1)
+	negative := v>>uint(p.FloatExponent+p.FloatMantissa)&1 == 1
+	var result float64
+	switch biased {
+	case 1<<uint(p.FloatExponent) - 1:
+		if m != 0 {
+			return math.NaN()
+		}
+		if negative && p.InfNegDefined {
+			return p.InfNeg
+		}
+		if !negative && p.InfPosDefined {
+			return p.InfPos
+		}
+		result = math.Inf(1)
+	case 0:
+		result = math.Ldexp(float64(m), 1-p.floatBias()-p.FloatMantissa)
+	default:
+		result = math.Ldexp(float64(m|(mantissaMask+1)), biased-p.floatBias()-p.FloatMantissa)
+	}
+	if negative {
+		return -result
+	}
+	return result
+}
+
+// floatCoding codes value as reduced precision float. Range and steps come from format. Only for float fields, integers do not have ±Inf or NaN
+func floatCoding(result PiecewiseCoding, dir DirectiveSettings, typename string) (PiecewiseCoding, error) {
+	if typename != "float64" && typename != "float32" {
+		return result, fmt.Errorf("%v float coding requires float field, not %v", result.Name, typename)
+	}
+	if dir.MinDefined || dir.MaxDefined || 0 < len(dir.Steps) || 0 < dir.Bits || dir.Clamped || dir.Log || 0 < len(dir.Table) || 0 < len(dir.Specials) || dir.Rounding != ROUNDING_NEAREST {
+		return result, fmt.Errorf("%v float coding does not support range, steps, clamping, log, table, special or rounding directives", result.Name)
+	}
+	result.FloatExponent = dir.FloatExponent
+	result.FloatMantissa = dir.FloatMantissa
+	result.Min = -result.floatMax() //Informative
+	return result, result.floatIsInvalid()
+}
+
+func (p *PiecewiseCoding) floatIsInvalid() error {
+	errBits := floatBitsIsInvalid(p.FloatExponent, p.FloatMantissa)
+	if errBits != nil {
+		return fmt.Errorf("%v %v", p.Name, errBits.Error())
+	}
+	if p.Clamped || 0 < len(p.Steps) || 0 < len(p.Table) || 0 < len(p.Specials) || p.Log || p.Circular {
+		return fmt.Errorf("%v float coding can not have clamping, steps, table, special codes, log or circular", p.Name)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package splurts
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type UnknownRangeMeas struct {
+	Raw  float64 `splurts:"float=16"`
+	Gain float32 `splurts:"float=bf16"`
+	Q    float64 `splurts:"minifloat=e4m3"`
+	Temp float64 `splurts:"min=-40,max=85,step=0.5"`
+}
+
+type BadFloatRange struct {
+	Raw float64 `splurts:"float=16,min=0"`
+}
+
+type BadFloatFormat struct {
+	Raw float64 `splurts:"minifloat=e1m3"`
+}
+
+type BadFloatInteger struct {
+	I int32 `splurts:"float=16"`
+}
+
+func TestParseFloatFormat(t *testing.T) {
+	cases := []struct {
+		format   string
+		exponent int
+		mantissa int
+	}{{"16", 5, 10}, {"bf16", 8, 7}, {"32", 8, 23}, {"e4m3", 4, 3}, {"e5m2", 5, 2}}
+	for _, c := range cases {
+		exponent, mantissa, err := ParseFloatFormat(c.format)
+		assert.Equal(t, nil, err, c.format)
+		assert.Equal(t, c.exponent, exponent, c.format)
+		assert.Equal(t, c.mantissa, mantissa, c.format)
+	}
+	for _, bad := range []string{"", "8", "e4", "m3", "e1m3", "e4m0", "eXm3"} {
+		_, _, err := ParseFloatFormat(bad)
+		assert.NotEqual(t, nil, err, bad)
+	}
+}
+
+func TestHalfFloatCodes(t *testing.T) {
+	half := PiecewiseCoding{Name: "half", FloatExponent: 5, FloatMantissa: 10}
+	assert.Equal(t, nil, half.IsInvalid())
+	assert.Equal(t, 16, half.NumberOfBits())
+	assert.Equal(t, "e5m10", half.FloatFormat())
+	assert.Equal(t, 65504.0, half.Max())
+
+	codes := []struct {
+		value float64
+		code  uint64
+	}{
+		{1, 0x3C00}, {-2, 0xC000}, {0.1, 0x2E66}, {65504, 0x7BFF}, {65520, 0x7C00},
+		{math.Inf(1), 0x7C00}, {math.Inf(-1), 0xFC00}, {6e-8, 0x0001}, {1e-8, 0}, {math.Copysign(0, -1), 0x8000},
+	}
+	for _, c := range codes {
+		assert.Equal(t, c.code, half.ScaleToUint(c.value), "%v", c.value)
+	}
+	assert.Equal(t, 1.0, half.ScaleToFloat(0x3C00))
+	assert.Equal(t, math.Ldexp(1, -24), half.ScaleToFloat(0x0001))
+	assert.Equal(t, math.Inf(-1), half.ScaleToFloat(0xFC00))
+	assert.True(t, math.IsNaN(half.ScaleToFloat(half.ScaleToUint(math.NaN()))))
+	assert.True(t, math.IsNaN(half.ScaleToFloat(half.MaxCode())), "missing value code")
+
+	bf16 := PiecewiseCoding{Name: "bf16", FloatExponent: 8, FloatMantissa: 7}
+	assert.Equal(t, uint64(0x3F80), bf16.ScaleToUint(1))
+	assert.Equal(t, uint64(0x4049), bf16.ScaleToUint(math.Pi))
+
+	single := PiecewiseCoding{Name: "single", FloatExponent: 8, FloatMantissa: 23}
+	for _, f := range []float64{1.5, -3.25e-3, 123456.789, 1e-40, 3e38, 1e39} {
+		assert.Equal(t, uint64(math.Float32bits(float32(f))), single.ScaleToUint(f), "same as float32 %v", f)
+		assert.Equal(t, float64(float32(f)), single.ScaleToFloat(single.ScaleToUint(f)))
+	}
+
+	e4m3 := PiecewiseCoding{Name: "e4m3", FloatExponent: 4, FloatMantissa: 3}
+	assert.Equal(t, 240.0, e4m3.Max())
+	assert.Equal(t, 8, e4m3.NumberOfBits())
+	assert.Equal(t, 16.0, e4m3.MaxStep())
+}
+
+func TestFloatFields(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(UnknownRangeMeas{})
+	assert.Equal(t, nil, errRecipe)
+	assert.Equal(t, nil, recipe.IsInvalid())
+	assert.Equal(t, 16+16+8+8, recipe.NumberOfBits())
+	assert.Equal(t, "e8m7", recipe[1].FloatFormat())
+
+	d := UnknownRangeMeas{Raw: 1234.5, Gain: 3e20, Q: math.Inf(-1), Temp: 21}
+	byt, errSplurt := recipe.Splurts(d)
+	assert.Equal(t, nil, errSplurt)
+	back := UnknownRangeMeas{}
+	assert.Equal(t, nil, recipe.UnSplurts(byt, &back))
+	assert.Equal(t, 1234.0, back.Raw, "ties to even")
+	assert.InDelta(t, 3e20, back.Gain, recipe[1].QuantizationErrorAt(3e20))
+	assert.Equal(t, math.Inf(-1), back.Q)
+
+	d.Raw = 0.1
+	d.Q = math.NaN()
+	strs, errStrings := recipe.ToStrings(d, false)
+	assert.Equal(t, nil, errStrings)
+	assert.Equal(t, "0.10000", strs["Raw"], "decimals follow local step")
+	assert.Equal(t, "NaN", strs["Q"])
+	d.Raw = 0
+	strs, _ = recipe.ToStrings(d, false)
+	assert.Equal(t, "0", strs["Raw"])
+
+	_, errRange := GetPiecewisesFromStruct(BadFloatRange{})
+	assert.NotEqual(t, nil, errRange)
+	_, errFormat := GetPiecewisesFromStruct(BadFloatFormat{})
+	assert.NotEqual(t, nil, errFormat)
+	_, errInteger := GetPiecewisesFromStruct(BadFloatInteger{})
+	assert.NotEqual(t, nil, errInteger, "integer can not be Inf")
+}
@@ -8,6 +8,7 @@ package splurts
 import (
 	"fmt"
 	"math"
+	"math/bits"
 	"strconv"
 )
 
@@ -20,6 +21,14 @@ type PiecewiseCoding struct {
 	Clamped bool //No  NaN  -Inf +Inf, just raw value.. Used for flags etc...
 	Enums   []string
 
+	EnumCodes   []uint64 //Explicit codes of enums, nil means codes by position starting from 1
+	EnumUnknown string   //Enum used for unknown strings and codes. Empty means error
+
+	Flags []string //Bit flag set, one bit per flag. First flag is lowest bit
+
+	TextLength int    //Max length of fixed length text, 0 is not text
+	Alphabet   string //Alphabet of text like sixbit, baudot or ascii
+
 	InfPosDefined bool
 	InfNegDefined bool
 	InfPos        float64
@@ -28,15 +37,62 @@ type PiecewiseCoding struct {
 	Const        float64
 	ConstDefined bool
 	Meta         DirectiveMetadata
+
+	Epoch      bool   //Base for relative time fields
+	RelativeTo string //Name of epoch field. Value is milliseconds from epoch
+
+	Log bool //Step sizes are relative, each step multiplies value by 1+Size. Constant relative precision, Min must be positive
+
+	Table []CalibrationPoint //Calibration table, linear interpolation between breakpoints. Used instead of Min and Steps
+
+	Rounding RoundingMode //How values between codes are rounded
+	Dither   DitherSource //Random source for ROUNDING_DITHER, nil uses math/rand
+
+	Specials []string //Named special codes reserved below +inf code, like DISCONNECTED. Decoded as SpecialValue
+
+	Circular bool //Values wrap around from max to min like angles. Always clamped
+
+	Geo string //GEOLAT or GEOLON when coding is part of geo position
+
+	Block *BlockCoding //Block floating point exponent or element. Element code is mantissa relative to exponent coded before
+
+	FloatExponent int //Exponent bits of reduced precision float like half or bfloat16, 0 is not float. Min is informative
+	FloatMantissa int //Mantissa bits of float without hidden bit
+
+	Deadband        float64 //Change required before DeadbandEncoder sends value again. 0 sends on any change
+	DeadbandDefined bool    //Without deadband value is sent on every record
+}
+
+// codeValued tells that value is code itself, like on enums, flags and text
+func (p *PiecewiseCoding) codeValued() bool {
+	return 0 < len(p.Enums) || 0 < len(p.Flags) || 0 < p.TextLength
 }
 
 func (p *PiecewiseCoding) MinStep() float64 {
-	if 0 < len(p.Enums) {
+	if p.codeValued() || p.isBlockExponent() {
 		return 1
 	}
+	if p.Block != nil {
+		return p.Block.Step(float64(p.Block.MinExponent))
+	}
+	if p.isFloat() {
+		return p.floatStep(0)
+	}
+	if 1 < len(p.Table) {
+		return p.tableMinStep()
+	}
 	if len(p.Steps) == 0 {
 		return 0
 	}
+	if p.Log { //Smallest absolute step is at start of some part
+		total := p.Min
+		minStep := math.Abs(total * p.Steps[0].Size)
+		for _, step := range p.Steps {
+			minStep = math.Min(minStep, math.Abs(total*step.Size))
+			total *= math.Pow(1+step.Size, float64(step.Count))
+		}
+		return minStep
+	}
 	minStep := math.Abs(p.Steps[0].Size)
 	for _, step := range p.Steps {
 		minStep = math.Min(minStep, math.Abs(step.Size))
@@ -44,12 +100,61 @@ func (p *PiecewiseCoding) MinStep() float64 {
 	return minStep
 }
 
+// LocalStep step size near value f. On log coding step grows with value
+func (p *PiecewiseCoding) LocalStep(f float64) float64 {
+	if p.codeValued() || p.isBlockExponent() {
+		return 1
+	}
+	if p.Block != nil { //When f is largest value on block
+		return p.Block.Step(p.Block.exponentOf(math.Abs(f)))
+	}
+	if p.isFloat() {
+		return p.floatStep(f)
+	}
+	if 1 < len(p.Table) {
+		return p.tableLocalStep(f)
+	}
+	if len(p.Steps) == 0 {
+		return 0
+	}
+	total := p.Min
+	for _, step := range p.Steps {
+		if p.Log {
+			total *= math.Pow(1+step.Size, float64(step.Count))
+		} else {
+			total += float64(step.Count) * step.Size
+		}
+		if f <= total {
+			if p.Log {
+				return math.Abs(math.Max(f, p.Min) * step.Size)
+			}
+			return math.Abs(step.Size)
+		}
+	}
+	last := p.Steps[len(p.Steps)-1].Size
+	if p.Log {
+		return math.Abs(total * last)
+	}
+	return math.Abs(last)
+}
+
+// decimalsForStep how many decimals are needed for showing step
+func decimalsForStep(step float64) int {
+	if 1 < step || step == 0 {
+		return 0
+	}
+	return int(math.Ceil(math.Abs(math.Log10(step))))
+}
+
 // Decimals Tells how many decimals are required for float. 0=integer 1=0.1 2=0.2
 func (p *PiecewiseCoding) Decimals() int {
-	if 0 < len(p.Enums) {
+	if p.codeValued() {
 		return 0
 	}
-	if len(p.Steps) == 0 {
+	if p.Block != nil { //Finest step of elements, exponent is integer
+		return decimalsForStep(p.MinStep())
+	}
+	if len(p.Steps) == 0 && len(p.Table) == 0 {
 		return 0
 	}
 	/*	minStep := math.Abs(p.Steps[0].Size)
@@ -57,18 +162,29 @@ func (p *PiecewiseCoding) Decimals() int {
 			minStep = math.Min(minStep, math.Abs(step.Size))
 		}
 	*/
-	minStep := p.MinStep()
-	if 1 < minStep {
-		return 0
-	}
-
-	return int(math.Ceil(math.Abs(math.Log10(minStep))))
+	return decimalsForStep(p.MinStep())
 }
 
 func (p *PiecewiseCoding) ToStringValue(f float64) (string, error) {
+	if name := p.SpecialName(f); name != "" {
+		return name, nil
+	}
+	if 0 < len(p.Flags) {
+		return p.flagsToString(f)
+	}
+	if 0 < p.TextLength {
+		return p.textToString(f)
+	}
 	if len(p.Enums) == 0 {
+		decimals := p.Decimals()
+		if (p.Log || 0 < len(p.Table) || p.isFloat()) && !math.IsNaN(f) && !math.IsInf(f, 0) { //Follows local step
+			decimals = decimalsForStep(p.LocalStep(f))
+		}
+		if p.isFloat() && f == 0 { //Step of subnormals is not meaningful for zero
+			decimals = 0
+		}
 		//handling negative zero
-		formatstring := fmt.Sprintf("%%.%vf", p.Decimals())
+		formatstring := fmt.Sprintf("%%.%vf", decimals)
 		s := fmt.Sprintf(formatstring, f)
 
 		f2, errInternal := strconv.ParseFloat(s, 64)
@@ -80,14 +196,10 @@ func (p *PiecewiseCoding) ToStringValue(f float64) (string, error) {
 		}
 		return s, nil
 	}
-	n := int(f)
-	if n == 0 {
-		return "", nil //First is empty string
-	}
-	if len(p.Enums) < n || n < 0 {
-		return "", fmt.Errorf("have %v enums+empty, index is %v", len(p.Enums), n)
+	if f < 0 {
+		return "", fmt.Errorf("enum %v code is negative %v", p.Name, f)
 	}
-	return p.Enums[n-1], nil
+	return p.EnumName(uint64(f))
 }
 
 func (p PiecewiseCoding) String() string {
@@ -98,6 +210,39 @@ func (p PiecewiseCoding) String() string {
 	} else {
 		result += " )"
 	}
+	if p.Log {
+		result += " log"
+	}
+	if p.Rounding != ROUNDING_NEAREST {
+		result += " " + p.Rounding.String()
+	}
+	if 0 < len(p.Specials) {
+		result += fmt.Sprintf(" special %v", p.Specials)
+	}
+	if p.Circular {
+		result += " circular"
+	}
+	if p.Geo != "" {
+		result += " geo " + p.Geo
+	}
+	if p.isFloat() {
+		return result + " float " + p.FloatFormat()
+	}
+	if p.isBlockExponent() {
+		return result + fmt.Sprintf(" block exponent %v..%v", p.Block.MinExponent, p.Block.MaxExponent())
+	}
+	if p.Block != nil {
+		return result + fmt.Sprintf(" block %v mantissa", p.Block.Name)
+	}
+	if 0 < len(p.Flags) {
+		return result + fmt.Sprintf(" flags %v", p.Flags)
+	}
+	if 0 < p.TextLength {
+		return result + fmt.Sprintf(" text %v %v", p.TextLength, p.Alphabet)
+	}
+	if 0 < len(p.Table) {
+		return result + fmt.Sprintf(" table %v", p.Table)
+	}
 	result += fmt.Sprintf(" from %v,  ", p.Min)
 	for _, step := range p.Steps {
 		result += step.String() + " "
@@ -118,9 +263,20 @@ func (p PiecewiseCodingStep) String() string {
 
 // Max helper function
 func (p *PiecewiseCoding) Max() float64 {
+	if p.isFloat() {
+		return p.floatMax()
+	}
+	if 1 < len(p.Table) {
+		_, highest := p.tableRange()
+		return highest.Value
+	}
 	result := p.Min
 	for _, step := range p.Steps {
-		result += step.Size * float64(step.Count)
+		if p.Log {
+			result *= math.Pow(1+step.Size, float64(step.Count))
+		} else {
+			result += step.Size * float64(step.Count)
+		}
 	}
 	return result
 }
@@ -130,11 +286,38 @@ func (p *PiecewiseCoding) IsInvalid() error {
 	if len(p.Name) == 0 {
 		return fmt.Errorf("name missing")
 	}
+	if p.Block != nil {
+		return p.Block.isInvalid()
+	}
+	if p.isFloat() {
+		return p.floatIsInvalid()
+	}
 	if 0 < len(p.Enums) {
 		if !p.Clamped {
 			return fmt.Errorf("internal error enums must be clamped not automatic +inf -inf")
 		}
-		return nil
+		return p.enumsIsInvalid()
+	}
+	if 0 < len(p.Flags) {
+		return p.flagsIsInvalid()
+	}
+	if 0 < p.TextLength {
+		return p.textIsInvalid()
+	}
+	if p.Circular {
+		errCircular := p.circularIsInvalid()
+		if errCircular != nil {
+			return errCircular
+		}
+	}
+	if 0 < len(p.Specials) {
+		errSpecial := p.specialsIsInvalid()
+		if errSpecial != nil {
+			return errSpecial
+		}
+	}
+	if 0 < len(p.Table) {
+		return p.tableIsInvalid()
 	}
 	if len(p.Steps) == 0 {
 		return fmt.Errorf("no steps defined at %v", p.Name)
@@ -145,13 +328,31 @@ func (p *PiecewiseCoding) IsInvalid() error {
 			return fmt.Errorf("invalid step %#v at index %v", step, i)
 		}
 	}
+	if p.Log && p.Min <= 0 {
+		return fmt.Errorf("log coding %v requires positive min, got %v", p.Name, p.Min)
+	}
 	return nil
 }
 
 // TotalStepCount helper function
 func (p *PiecewiseCoding) TotalStepCount() uint64 {
+	if p.Block != nil {
+		return 1 << uint(p.blockBits())
+	}
+	if p.isFloat() {
+		return 1 << uint(1+p.FloatExponent+p.FloatMantissa)
+	}
 	if 0 < len(p.Enums) {
-		return uint64(len(p.Enums)) + 1
+		return p.maxEnumCode() + 1
+	}
+	if 0 < len(p.Flags) {
+		return 1 << uint(len(p.Flags))
+	}
+	if 0 < p.TextLength {
+		return 1 << uint(p.textBits())
+	}
+	if 0 < len(p.Table) {
+		return p.Table[len(p.Table)-1].Code + 1
 	}
 	n := uint64(0)
 	for _, st := range p.Steps {
@@ -166,19 +367,39 @@ func (p *PiecewiseCoding) NumberOfBits() int {
 		return 0
 	}
 	if 0 < len(p.Enums) {
-		return int(math.Ceil(math.Log2(float64(len(p.Enums) + 1))))
+		return bitsForCodes(p.maxEnumCode() + 1)
 	}
-	n := p.TotalStepCount()
-	if p.Clamped {
-		return int(math.Ceil(math.Log2(float64(n))))
+	if 0 < len(p.Flags) {
+		return len(p.Flags)
+	}
+	if 0 < p.TextLength {
+		return p.textBits()
+	}
+	if p.Block != nil {
+		return p.blockBits()
+	}
+	if p.isFloat() {
+		return 1 + p.FloatExponent + p.FloatMantissa
+	}
+	// not defined NaN, -inf and +inf needed, ->three extra steps. Special codes are extra also
+	return bitsForCodes(p.TotalStepCount() + p.reservedCodes())
+}
+
+// bitsForCodes how many bits are needed for n different codes. Same as ceil(log2(n)) without float rounding
+func bitsForCodes(n uint64) int {
+	if n == 0 {
+		return 0
 	}
-	// not defined NaN, -inf and +inf needed, ->three extra steps
-	return int(math.Ceil(math.Log2(float64(n + 3))))
+	return bits.Len64(n - 1)
 }
 
 // MaxCode Maximum code possible.
 func (p *PiecewiseCoding) MaxCode() uint64 {
-	return uint64(math.Pow(2, float64(p.NumberOfBits())) - 1)
+	n := p.NumberOfBits()
+	if 64 <= n {
+		return math.MaxUint64
+	}
+	return (uint64(1) << uint(n)) - 1
 }
 
 // Scales float array to uint64 array. TODO optimize for array operation later
@@ -204,13 +425,28 @@ func (p *PiecewiseCoding) ScaleToIntArr(fArr []float64) []int64 {
 // ScaleToUint converts float to step number.
 func (p *PiecewiseCoding) ScaleToUint(f float64) uint64 {
 
-	if 0 < len(p.Enums) {
+	if p.Block != nil { //Element alone is coded with smallest exponent
+		return p.scaleBlockToUint(f)
+	}
+	if p.isFloat() {
+		return p.scaleFloatToUint(f)
+	}
+	if p.codeValued() {
 		return uint64(f)
 	}
 
 	if math.IsNaN(f) {
+		if index, isSpecial := SpecialIndex(f); isSpecial && index < len(p.Specials) {
+			return p.specialCode(index)
+		}
 		return p.MaxCode()
 	}
+	if p.Circular {
+		return p.scaleCircularToUint(f)
+	}
+	if 0 < len(p.Table) {
+		return p.scaleTableToUint(f)
+	}
 	if f < p.Min {
 		return 0 //Coded as -inf or in raw as just 0
 	}
@@ -219,9 +455,18 @@ func (p *PiecewiseCoding) ScaleToUint(f float64) uint64 {
 	maxcode := p.MaxCode()
 	for _, step := range p.Steps {
 		a := total
-		total += float64(step.Count) * step.Size
+		if p.Log {
+			total *= math.Pow(1+step.Size, float64(step.Count))
+		} else {
+			total += float64(step.Count) * step.Size
+		}
 		if f <= total {
-			result := stepcounter + uint64(math.Round((f-a)/step.Size)) //Round vs floor vs ceil?
+			var result uint64
+			if p.Log { //Rounding is done in log space
+				result = stepcounter + p.roundSteps(math.Log(f/a)/math.Log1p(step.Size), step.Count, false)
+			} else {
+				result = stepcounter + p.roundSteps((f-a)/step.Size, step.Count, false)
+			}
 			if !p.Clamped {
 				result++
 			}
@@ -277,13 +522,25 @@ func (p *PiecewiseCoding) HexCodeMax() string {
 
 // ScaleToFloat scales unsigned integer presentation to actual measurement float
 func (p *PiecewiseCoding) ScaleToFloat(v uint64) float64 {
+	if p.Block != nil {
+		return p.blockToFloat(v)
+	}
+	if p.isFloat() {
+		return p.floatToFloat(v)
+	}
+	if p.codeValued() {
+		return float64(v)
+	}
+	if p.Circular {
+		return p.circularToFloat(v)
+	}
 	maxv := p.MaxCode()
 	if !p.Clamped {
 		//NaN for case like where measurement result readout failed due hardware fail
 		if v == maxv {
 			return math.NaN()
 		}
-		if v == 0 {
+		if v == p.negInfCode() {
 			if p.InfNegDefined {
 				return p.InfNeg
 			}
@@ -295,8 +552,14 @@ func (p *PiecewiseCoding) ScaleToFloat(v uint64) float64 {
 			}
 			return math.Inf(1)
 		}
+		if index, isSpecial := p.specialOfCode(v); isSpecial {
+			return SpecialValue(index)
+		}
 	}
 
+	if 0 < len(p.Table) {
+		return p.tableToFloat(v)
+	}
 	binvalue := uint64(1) // 0=-inf
 	if p.Clamped {
 		binvalue = 0
@@ -306,11 +569,21 @@ func (p *PiecewiseCoding) ScaleToFloat(v uint64) float64 {
 		a := binvalue
 		binvalue += uint64(step.Count)
 		if v <= binvalue { //Is in this part
+			if p.Log {
+				return total * math.Pow(1+step.Size, float64(v-a))
+			}
 			return total + float64(v-a)*step.Size //Round vs floor vs ceil?
 		}
-		total += float64(step.Count) * step.Size
+		if p.Log {
+			total *= math.Pow(1+step.Size, float64(step.Count))
+		} else {
+			total += float64(step.Count) * step.Size
+		}
 	}
 	if p.Clamped { //Extrapolate up with latest step size. Usually should not need
+		if p.Log {
+			return total * math.Pow(1+p.Steps[len(p.Steps)-1].Size, float64(v-uint64(p.TotalStepCount())))
+		}
 		return total + float64(v-uint64(p.TotalStepCount()))*p.Steps[len(p.Steps)-1].Size
 	}
 	if p.InfPosDefined {
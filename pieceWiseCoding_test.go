@@ -235,3 +235,34 @@ func TestCode(t *testing.T) {
 	code, _ = dut2.BitCode(2)
 	assert.Equal(t, 2, len(code))
 }
+
+func TestLogCoding(t *testing.T) {
+	dut := PiecewiseCoding{
+		Name:  "dose",
+		Min:   0.01,
+		Log:   true,
+		Steps: []PiecewiseCodingStep{{Size: 0.01, Count: 1389}},
+	}
+	assert.Equal(t, nil, dut.IsInvalid())
+	assert.Equal(t, 11, dut.NumberOfBits())
+	assert.InDelta(t, 10000, dut.Max(), 10000*0.01)
+
+	for _, f := range []float64{0.01, 0.0123, 1, 3.7, 512, 9876} {
+		back := dut.ScaleToFloat(dut.ScaleToUint(f))
+		assert.InEpsilon(t, f, back, 0.005, "relative error of %v", f)
+	}
+	assert.True(t, math.IsInf(dut.ScaleToFloat(dut.ScaleToUint(0.001)), -1))
+	assert.True(t, math.IsInf(dut.ScaleToFloat(dut.ScaleToUint(20000)), 1))
+	assert.True(t, math.IsNaN(dut.ScaleToFloat(dut.ScaleToUint(math.NaN()))))
+
+	assert.InDelta(t, 0.0001, dut.MinStep(), 1e-12)
+	assert.Equal(t, 4, dut.Decimals())
+	assert.InDelta(t, 50, dut.LocalStep(5000), 1e-9)
+	s, _ := dut.ToStringValue(dut.ScaleToFloat(dut.ScaleToUint(0.0123)))
+	assert.Equal(t, "0.0123", s)
+	s, _ = dut.ToStringValue(dut.ScaleToFloat(dut.ScaleToUint(5000)))
+	assert.Equal(t, "5011", s)
+
+	dut.Min = 0
+	assert.NotEqual(t, nil, dut.IsInvalid())
+}
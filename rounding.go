@@ -0,0 +1,146 @@
+/*
+Rounding of values to codes. Default is nearest, floor and ceil for values that must not be over or under reported and dithered for statistical averaging
+*/
+
+package splurts
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// RoundingMode how value between two codes is rounded
+type RoundingMode int
+
+const (
+	ROUNDING_NEAREST RoundingMode = iota //Default
+	ROUNDING_FLOOR                       //Never over reports, like remaining battery
+	ROUNDING_CEIL                        //Never under reports
+	ROUNDING_DITHER                      //Stochastic rounding, average of many values is not biased
+)
+
+const roundingTolerance = 1e-9 //In steps
+
+var roundingNames = []string{"nearest", "floor", "ceil", "dither"}
+
+func (p RoundingMode) String() string {
+	if p < 0 || int(p) >= len(roundingNames) {
+		return fmt.Sprintf("RoundingMode(%d)", int(p))
+	}
+	return roundingNames[p]
+}
+
+// ParseRoundingMode parses name used on round directive
+func ParseRoundingMode(s string) (RoundingMode, error) {
+	for i, name := range roundingNames {
+		if name == s {
+			return RoundingMode(i), nil
+		}
+	}
+	return ROUNDING_NEAREST, fmt.Errorf("unknown rounding mode %v, valid are %v", s, roundingNames)
+}
+
+// DitherSource gives uniform random numbers in [0,1) for dithered rounding. *rand.Rand from math/rand works for seeded source.
+// Source is called from encode, so source shared between goroutines must be safe for concurrent use
+type DitherSource interface {
+	Float64() float64
+}
+
+type globalDitherSource struct{}
+
+func (globalDitherSource) Float64() float64 {
+	return rand.Float64()
+}
+
+// SetDitherSource sets source for all dithered codings. nil uses math/rand global source
+func (p *PiecewiseFloats) SetDitherSource(src DitherSource) {
+	for i := range *p {
+		(*p)[i].Dither = src
+	}
+}
+
+// roundSteps rounds x steps to integer step count limited to max. On descending part floor and ceil are swapped so that floor still never over reports value
+func (p *PiecewiseCoding) roundSteps(x float64, max uint64, descending bool) uint64 {
+	mode := p.Rounding
+	if descending && mode == ROUNDING_FLOOR {
+		mode = ROUNDING_CEIL
+	} else if descending && mode == ROUNDING_CEIL {
+		mode = ROUNDING_FLOOR
+	}
+	if nearest := math.Round(x); math.Abs(x-nearest) < roundingTolerance {
+		x = nearest //Value exactly on code must not move to next code because of floating point error like 0.3/0.1
+	}
+	switch mode {
+	case ROUNDING_FLOOR:
+		x = math.Floor(x)
+	case ROUNDING_CEIL:
+		x = math.Ceil(x)
+	case ROUNDING_DITHER:
+		src := p.Dither
+		if src == nil {
+			src = globalDitherSource{}
+		}
+		x = math.Floor(x + src.Float64())
+	default:
+		x = math.Round(x)
+	}
+	if x <= 0 {
+		return 0
+	}
+	if float64(max) < x {
+		return max
+	}
+	return uint64(x)
+}
+
+// MaxStep largest step on coding. On log coding step grows with value
+func (p *PiecewiseCoding) MaxStep() float64 {
+	if p.codeValued() || p.isBlockExponent() {
+		return 1
+	}
+	if p.Block != nil {
+		return p.Block.Step(float64(p.Block.MaxExponent()))
+	}
+	if p.isFloat() {
+		return p.floatStep(p.floatMax())
+	}
+	if 1 < len(p.Table) {
+		result := p.tableSlope(1)
+		for i := 2; i < len(p.Table); i++ {
+			result = math.Max(result, p.tableSlope(i))
+		}
+		return result
+	}
+	result := float64(0)
+	total := p.Min
+	for _, step := range p.Steps {
+		if p.Log {
+			total *= math.Pow(1+step.Size, float64(step.Count))
+			result = math.Max(result, math.Abs(total*step.Size/(1+step.Size))) //Last step of part
+		} else {
+			result = math.Max(result, math.Abs(step.Size))
+		}
+	}
+	return result
+}
+
+// QuantizationError worst case absolute error of coding with rounding mode of coding. Nearest is half step, others are full step
+func (p *PiecewiseCoding) QuantizationError() float64 {
+	return p.quantizationError(p.MaxStep())
+}
+
+// QuantizationErrorAt worst case absolute error near value f
+func (p *PiecewiseCoding) QuantizationErrorAt(f float64) float64 {
+	return p.quantizationError(p.LocalStep(f))
+}
+
+func (p *PiecewiseCoding) quantizationError(step float64) float64 {
+	if p.codeValued() {
+		return 0
+	}
+	if p.Rounding == ROUNDING_NEAREST {
+		return step / 2
+	}
+	return step
+}
@@ -0,0 +1,111 @@
+package splurts
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type BatteryMeas struct {
+	Remaining float64 `splurts:"min=0,max=100,step=0.5,clamped,round=floor"`
+	Dose      float64 `splurts:"min=0,max=10,step=0.1,round=ceil"`
+	Load      float64 `splurts:"min=0,max=10,step=1,clamped,round=dither"`
+}
+
+func TestRoundingModes(t *testing.T) {
+	dut := PiecewiseCoding{Name: "a", Min: 0, Clamped: true, Steps: []PiecewiseCodingStep{{Size: 1, Count: 10}}}
+	cases := []struct {
+		mode    RoundingMode
+		in      float64
+		code    uint64
+		maxErr  float64
+		errName string
+	}{
+		{ROUNDING_NEAREST, 3.4, 3, 0.5, "nearest"},
+		{ROUNDING_NEAREST, 3.6, 4, 0.5, "nearest"},
+		{ROUNDING_FLOOR, 3.9, 3, 1, "floor"},
+		{ROUNDING_CEIL, 3.1, 4, 1, "ceil"},
+		{ROUNDING_CEIL, 9.5, 10, 1, "ceil"},
+	}
+	for _, c := range cases {
+		dut.Rounding = c.mode
+		assert.Equal(t, c.code, dut.ScaleToUint(c.in), "%v %v", c.mode, c.in)
+		assert.Equal(t, c.maxErr, dut.QuantizationError())
+		assert.Equal(t, c.errName, c.mode.String())
+	}
+
+	tenths := PiecewiseCoding{Name: "b", Min: 0, Clamped: true, Rounding: ROUNDING_FLOOR, Steps: []PiecewiseCodingStep{{Size: 0.1, Count: 10}}}
+	assert.Equal(t, uint64(3), tenths.ScaleToUint(0.3), "0.3/0.1 is not exactly 3 on float64")
+
+	//Floor never over reports on descending calibration table
+	ntc := PiecewiseCoding{Name: "ntc", Clamped: true, Rounding: ROUNDING_FLOOR, Table: []CalibrationPoint{{Code: 0, Value: 100}, {Code: 100, Value: 0}}}
+	for _, f := range []float64{0.5, 33.3, 99.9} {
+		assert.LessOrEqual(t, ntc.ScaleToFloat(ntc.ScaleToUint(f)), f)
+	}
+	ntc.Rounding = ROUNDING_CEIL
+	for _, f := range []float64{0.5, 33.3, 99.9} {
+		assert.GreaterOrEqual(t, ntc.ScaleToFloat(ntc.ScaleToUint(f)), f)
+	}
+
+	dose := PiecewiseCoding{Name: "dose", Min: 1, Log: true, Rounding: ROUNDING_FLOOR, Steps: []PiecewiseCodingStep{{Size: 0.01, Count: 500}}}
+	for _, f := range []float64{1.5, 12.34, 100} {
+		assert.LessOrEqual(t, dose.ScaleToFloat(dose.ScaleToUint(f)), f)
+	}
+	assert.InDelta(t, dose.Max()*0.01/1.01, dose.MaxStep(), 1e-9)
+	assert.InDelta(t, 0.1, dose.QuantizationErrorAt(10), 1e-9)
+
+	enum := PiecewiseCoding{Name: "e", Enums: []string{"A", "B"}, Clamped: true, Steps: []PiecewiseCodingStep{{Size: 1, Count: 2}}}
+	assert.Equal(t, float64(0), enum.QuantizationError())
+
+	_, errMode := ParseRoundingMode("truncate")
+	assert.NotEqual(t, nil, errMode)
+}
+
+func TestDitherRounding(t *testing.T) {
+	dut := PiecewiseCoding{Name: "a", Min: 0, Clamped: true, Rounding: ROUNDING_DITHER, Steps: []PiecewiseCodingStep{{Size: 1, Count: 10}}}
+	dut.Dither = rand.New(rand.NewSource(42))
+
+	sum := float64(0)
+	n := 10000
+	codes := make([]uint64, n)
+	for i := range codes {
+		codes[i] = dut.ScaleToUint(3.3)
+		assert.True(t, codes[i] == 3 || codes[i] == 4)
+		sum += dut.ScaleToFloat(codes[i])
+	}
+	assert.InDelta(t, 3.3, sum/float64(n), 0.02, "dithered average must not be biased")
+	assert.Equal(t, float64(1), dut.QuantizationError())
+
+	//Same seed gives same codes
+	dut.Dither = rand.New(rand.NewSource(42))
+	for i := range codes {
+		assert.Equal(t, codes[i], dut.ScaleToUint(3.3))
+	}
+}
+
+func TestRoundingDirective(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(BatteryMeas{})
+	assert.Equal(t, nil, errRecipe)
+	assert.Equal(t, ROUNDING_FLOOR, recipe[0].Rounding)
+	assert.Equal(t, ROUNDING_CEIL, recipe[1].Rounding)
+	assert.Equal(t, ROUNDING_DITHER, recipe[2].Rounding)
+	recipe.SetDitherSource(rand.New(rand.NewSource(1)))
+
+	d := BatteryMeas{Remaining: 49.9, Dose: 2.01, Load: 4}
+	byt, errSplurt := recipe.Splurts(d)
+	assert.Equal(t, nil, errSplurt)
+	back := BatteryMeas{}
+	assert.Equal(t, nil, recipe.UnSplurts(byt, &back))
+	assert.Equal(t, 49.5, back.Remaining)
+	assert.InDelta(t, 2.1, back.Dose, 1e-9)
+	assert.Equal(t, float64(4), back.Load)
+
+	assert.Equal(t, 0.5, recipe[0].QuantizationError())
+	assert.InDelta(t, 0.1, recipe[1].QuantizationError(), 1e-9)
+	assert.False(t, math.IsNaN(recipe[2].QuantizationError()))
+
+	_, errCoding := createPiecewiseCodingFromStruct("A", "float64", "min=0,max=1,step=0.1,round=up")
+	assert.NotEqual(t, nil, errCoding)
+}
@@ -0,0 +1,209 @@
+/*
+Sparse records. Presence bitmap with one bit per non omitted coding, first coding is first bit, followed by codes of present values only.
+Record length depends on present values. Missing values and NaN are not present, special codes are present
+*/
+
+package splurts
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// maskedValue gives value of coding i from values indexed like PiecewiseFloats. Exponent of block is picked by values of elements
+func (p *PiecewiseFloats) maskedValue(values []float64, i int) float64 {
+	if (*p)[i].isBlockExponent() {
+		f, _ := p.blockExponent(i, func(j int) (float64, error) { return values[j], nil })
+		return f
+	}
+	return values[i]
+}
+
+// sparsePresent tells is value present on sparse record
+func (p *PiecewiseFloats) sparsePresent(i int, f float64) bool {
+	return !math.IsNaN(f) || (*p)[i].SpecialName(f) != ""
+}
+
+// appendMasked writes presence bitmap and codes of present values. Without present func all codes are written without bitmap
+func (p *PiecewiseFloats) appendMasked(w *BitWriter, values []float64, present func(i int, f float64) bool) {
+	for i := range *p {
+		if (*p)[i].Omit || present == nil {
+			continue
+		}
+		bit := uint64(0)
+		if present(i, p.maskedValue(values, i)) {
+			bit = 1
+		}
+		w.WriteBits(bit, 1)
+	}
+	exponent := math.NaN() //Of latest block. Exponent must be present when its elements are
+	for i := range *p {
+		a := &(*p)[i]
+		if a.Omit {
+			continue
+		}
+		f := p.maskedValue(values, i)
+		if present != nil && !present(i, f) {
+			continue
+		}
+		if a.ConstDefined {
+			f = a.Const
+		}
+		w.WriteBits(a.codeOf(f, &exponent), a.NumberOfBits())
+	}
+}
+
+// SparseNumberOfBits bits of sparse record, bitmap and present values. Record is padded to full bytes
+func (p *PiecewiseFloats) SparseNumberOfBits(values []float64) int {
+	result := 0
+	for i, a := range *p {
+		if a.Omit {
+			continue
+		}
+		result++
+		if p.sparsePresent(i, p.maskedValue(values, i)) {
+			result += a.NumberOfBits()
+		}
+	}
+	return result
+}
+
+// AppendEncodeSparse appends sparse record of values (indexed same way as PiecewiseFloats) to dst. Use NaN for missing values
+func (p *PiecewiseFloats) AppendEncodeSparse(dst []byte, values []float64) ([]byte, error) {
+	if len(values) < len(*p) {
+		return dst, fmt.Errorf("have %v codings but only %v values", len(*p), len(values))
+	}
+	for i, a := range *p {
+		if !a.Omit && !math.IsNaN(values[i]) { //Missing value is not present
+			errCircular := a.circularValueIsInvalid(values[i])
+			if errCircular != nil {
+				return dst, errCircular
+			}
+		}
+	}
+	w := BitWriter{buf: dst, start: len(dst)}
+	p.appendMasked(&w, values, p.sparsePresent)
+	return w.buf, nil
+}
+
+// EncodeSparse codes map of values to sparse record. Names missing from map are not present
+func (p *PiecewiseFloats) EncodeSparse(values map[string]float64) ([]byte, error) {
+	arr := make([]float64, len(*p))
+	for i, a := range *p {
+		f, haz := values[a.Name]
+		if !haz {
+			f = math.NaN()
+		}
+		arr[i] = f
+	}
+	return p.AppendEncodeSparse(nil, arr)
+}
+
+// decodeMaskedEach checks and decodes record with presence bitmap from bit start, calls fn for each present value.
+// Dense record have all values without bitmap
+func (p *PiecewiseFloats) decodeMaskedEach(binarr []byte, start int, dense bool, fn func(i int, a *PiecewiseCoding, v float64) error) error {
+	bitmap := BitReader{buf: binarr, pos: start}
+	r := BitReader{buf: binarr, pos: start}
+	for _, a := range *p {
+		if !a.Omit && !dense {
+			r.pos++
+		}
+	}
+	if len(binarr)*8 < r.pos {
+		return fmt.Errorf("record have %v bytes, presence bitmap needs %v bits", len(binarr), r.pos)
+	}
+	exponent := math.NaN() //Of latest block
+	for i := range *p {
+		a := &(*p)[i]
+		if a.Omit {
+			continue
+		}
+		if !dense {
+			present, _ := bitmap.ReadBits(1)
+			if present == 0 {
+				continue
+			}
+		}
+		code, errRead := r.ReadBits(a.NumberOfBits())
+		if errRead != nil {
+			return fmt.Errorf("record is too short for %v: %v", a.Name, errRead.Error())
+		}
+		v, errCode := a.decodeCode(code, &exponent)
+		if errCode != nil {
+			return errCode
+		}
+		errFn := fn(i, a, v)
+		if errFn != nil {
+			return errFn
+		}
+	}
+	if 8 <= r.Remaining() {
+		return fmt.Errorf("record have %v extra bits", r.Remaining())
+	}
+	return nil
+}
+
+// DecodeSparse decodes sparse record to map of present values only
+func (p *PiecewiseFloats) DecodeSparse(binarr []byte) (map[string]float64, error) {
+	result := make(map[string]float64)
+	errDecode := p.decodeMaskedEach(binarr, 0, false, func(i int, a *PiecewiseCoding, v float64) error {
+		result[a.Name] = v
+		return nil
+	})
+	return result, errDecode
+}
+
+// SplurtsSparse splurts struct to sparse record. NaN values and nil pointers are not present
+func (p *PiecewiseFloats) SplurtsSparse(input interface{}) ([]byte, error) {
+	m, e := p.GetValuesToFloatMap(reflect.Indirect(reflect.ValueOf(input)).Interface())
+	if e != nil {
+		return nil, e
+	}
+	return p.EncodeSparse(m)
+}
+
+// UnSplurtsSparse decodes sparse record to output (pointer to struct). Fields that are not present are left untouched
+func (p *PiecewiseFloats) UnSplurtsSparse(raw []byte, output interface{}) error {
+	errInv := p.IsInvalid()
+	if errInv != nil {
+		return errInv
+	}
+	errDecode := p.decodeMaskedEach(raw, 0, false, func(i int, a *PiecewiseCoding, v float64) error { return nil })
+	if errDecode != nil {
+		return errDecode
+	}
+	return p.setFields(output, func(fn func(i int, a *PiecewiseCoding, v float64) error) error {
+		return p.decodeMaskedEach(raw, 0, false, fn)
+	})
+}
+
+// setFields sets fields of output (pointer to struct) from values given by each. Fields without value are left untouched
+func (p *PiecewiseFloats) setFields(output interface{}, each func(fn func(i int, a *PiecewiseCoding, v float64) error) error) error {
+	rv := reflect.ValueOf(output)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("pointer to struct required, got %v", rv.Kind())
+	}
+	elem := rv.Elem()
+	plan, errPlan := getStructPlan(elem.Type())
+	if errPlan != nil {
+		return errPlan
+	}
+	for _, relative := range []bool{false, true} { //Relative times after epoch is set
+		errSet := each(func(i int, a *PiecewiseCoding, v float64) error {
+			pf := plan.field(a.Name)
+			if pf == nil || (a.RelativeTo != "") != relative {
+				return nil
+			}
+			base, errBase := plan.epochField(a)
+			if errBase != nil {
+				return errBase
+			}
+			return a.setFieldValue(pf, base, elem, v)
+		})
+		if errSet != nil {
+			return errSet
+		}
+	}
+	return nil
+}
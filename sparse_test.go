@@ -0,0 +1,66 @@
+package splurts
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type SparseMeas struct {
+	Temp     float64  `splurts:"min=-40,max=85,step=0.5"`
+	Humidity *float64 `splurts:"min=0,max=100,step=1"`
+	Pressure float64  `splurts:"min=900,max=1100,step=0.1"`
+	Mode     string   `splurts:"enum=IDLE,RUN"`
+	Wind     float64  `splurts:"min=0,max=60,step=0.1"`
+}
+
+func TestSparse(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(SparseMeas{})
+	assert.Equal(t, nil, errRecipe)
+	assert.Equal(t, 38, recipe.NumberOfBits())
+
+	d := SparseMeas{Temp: 21.5, Pressure: math.NaN(), Mode: "RUN", Wind: math.NaN()}
+	byt, errSplurt := recipe.SplurtsSparse(&d)
+	assert.Equal(t, nil, errSplurt)
+	assert.Equal(t, 2, len(byt), "5 bit bitmap, 8 bit temp and 2 bit mode")
+	assert.Equal(t, []byte{0x93, 0xE4}, byt, "bitmap 10010, temp 01111100, mode 10")
+
+	m, errDecode := recipe.DecodeSparse(byt)
+	assert.Equal(t, nil, errDecode)
+	assert.Equal(t, map[string]float64{"Temp": 21.5, "Mode": 2}, m)
+
+	humidity := 55.0
+	back := SparseMeas{Humidity: &humidity, Pressure: 1013.2, Mode: "IDLE", Wind: 3.4}
+	assert.Equal(t, nil, recipe.UnSplurtsSparse(byt, &back))
+	assert.Equal(t, SparseMeas{Temp: 21.5, Humidity: &humidity, Pressure: 1013.2, Mode: "RUN", Wind: 3.4}, back, "absent fields are untouched")
+
+	onlyPressure, errEncode := recipe.EncodeSparse(map[string]float64{"Pressure": 1013.2})
+	assert.Equal(t, nil, errEncode)
+	assert.Equal(t, 2, len(onlyPressure))
+	m, errDecode = recipe.DecodeSparse(onlyPressure)
+	assert.Equal(t, nil, errDecode)
+	assert.InDelta(t, 1013.2, m["Pressure"], 1e-9)
+	assert.Equal(t, 1, len(m))
+
+	all := []float64{-3, 40, 950, 1, 12.5}
+	assert.Equal(t, 5+38, recipe.SparseNumberOfBits(all))
+	full, errFull := recipe.AppendEncodeSparse(nil, all)
+	assert.Equal(t, nil, errFull)
+	assert.Equal(t, 6, len(full))
+	m, errDecode = recipe.DecodeSparse(full)
+	assert.Equal(t, nil, errDecode)
+	assert.Equal(t, 5, len(m))
+	assert.Equal(t, 40.0, m["Humidity"])
+
+	_, errShort := recipe.DecodeSparse(full[:5])
+	assert.NotEqual(t, nil, errShort)
+	_, errLong := recipe.DecodeSparse(append(byt, 0))
+	assert.NotEqual(t, nil, errLong)
+
+	wind, _ := GetPiecewisesFromStruct(WindMeas{})
+	_, errMissing := wind.AppendEncodeSparse(nil, []float64{math.NaN(), 10, 20})
+	assert.Equal(t, nil, errMissing, "missing circular is not present")
+	_, errInf := wind.AppendEncodeSparse(nil, []float64{math.Inf(1), 10, 20})
+	assert.NotEqual(t, nil, errInf)
+}
@@ -0,0 +1,133 @@
+/*
+Reserved special codes. Non clamped coding can reserve named codes like DISCONNECTED or WARMUP below +inf code.
+Special code decodes to NaN carrying index of special on NaN payload, so code not knowing special codes sees just missing value.
+NaN payload is lost on arithmetic and some conversions, DecodeSpecials gives names of special codes read from codes of record
+*/
+
+package splurts
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	specialNaN   = uint64(0x7ff8_0000_0000_0000) | uint64(0x2b)<<45 //Quiet NaN with marker bits
+	specialShift = 29                                               //Index is on upper mantissa bits, so it survives conversion to float32
+	specialMask  = uint64(0xffff) << specialShift
+
+	MAXSPECIALCODES = 0xffff
+)
+
+// SpecialValue is NaN carrying index of special code. Use Special of PiecewiseCoding for getting value by name
+func SpecialValue(index int) float64 {
+	return math.Float64frombits(specialNaN | uint64(index)<<specialShift)
+}
+
+// SpecialIndex returns index of special code carried by value. Plain NaN and numbers are not special
+func SpecialIndex(f float64) (int, bool) {
+	b := math.Float64bits(f)
+	if b&^specialMask != specialNaN {
+		return 0, false
+	}
+	return int((b & specialMask) >> specialShift), true
+}
+
+// Special value of named special code, set this to field for coding special code
+func (p *PiecewiseCoding) Special(name string) (float64, error) {
+	for i, s := range p.Specials {
+		if s == name {
+			return SpecialValue(i), nil
+		}
+	}
+	return math.NaN(), fmt.Errorf("%v does not have special code %v", p.Name, name)
+}
+
+// SpecialName name of special code carried by value. Empty if value is not special code of this coding
+func (p *PiecewiseCoding) SpecialName(f float64) string {
+	index, isSpecial := SpecialIndex(f)
+	if !isSpecial || len(p.Specials) <= index {
+		return ""
+	}
+	return p.Specials[index]
+}
+
+// SpecialNameOfCode name of special code on wire. Empty if code is not special code of this coding
+func (p *PiecewiseCoding) SpecialNameOfCode(code uint64) string {
+	index, isSpecial := p.specialOfCode(code)
+	if !isSpecial || len(p.Specials) <= index {
+		return ""
+	}
+	return p.Specials[index]
+}
+
+// DecodeSpecials gives names of special codes on record by field name. Fields without special code are not on map
+func (p *PiecewiseFloats) DecodeSpecials(binarr []byte) (map[string]string, error) {
+	if p.NumberOfBytes() != len(binarr) {
+		return nil, fmt.Errorf("Struct have %v bits means %v bytes. BUT binary array have %v bytes", p.NumberOfBits(), p.NumberOfBytes(), len(binarr))
+	}
+	result := make(map[string]string)
+	r := BitReader{buf: binarr}
+	for i := range *p {
+		a := &(*p)[i]
+		if a.Omit {
+			continue
+		}
+		code, errRead := r.ReadBits(a.NumberOfBits())
+		if errRead != nil {
+			return nil, errRead
+		}
+		if name := a.SpecialNameOfCode(code); name != "" {
+			result[a.Name] = name
+		}
+	}
+	return result, nil
+}
+
+// reservedCodes how many codes are not used for values
+func (p *PiecewiseCoding) reservedCodes() uint64 {
+	if p.Clamped {
+		return 0
+	}
+	if len(p.Specials) == 0 {
+		return 3 //NaN, -inf and +inf
+	}
+	return 3 + uint64(len(p.Specials)) + 1 //Highest value code must not hit special code
+}
+
+// specialCode first special is just below +inf and rest are going downwards
+func (p *PiecewiseCoding) specialCode(index int) uint64 {
+	return p.MaxCode() - 2 - uint64(index)
+}
+
+// specialOfCode returns index of special code
+func (p *PiecewiseCoding) specialOfCode(v uint64) (int, bool) {
+	if p.Clamped || len(p.Specials) == 0 {
+		return 0, false
+	}
+	top := p.MaxCode() - 2
+	if top < v || v <= top-uint64(len(p.Specials)) {
+		return 0, false
+	}
+	return int(top - v), true
+}
+
+func (p *PiecewiseCoding) specialsIsInvalid() error {
+	if p.Clamped {
+		return fmt.Errorf("%v special codes require coding that is not clamped", p.Name)
+	}
+	if MAXSPECIALCODES < len(p.Specials) {
+		return fmt.Errorf("%v have %v special codes, max is %v", p.Name, len(p.Specials), MAXSPECIALCODES)
+	}
+	for i, name := range p.Specials {
+		if name == "" {
+			return fmt.Errorf("%v special code %v have no name", p.Name, i)
+		}
+		for _, other := range p.Specials[:i] {
+			if other == name {
+				return fmt.Errorf("%v special code %v is defined twice", p.Name, name)
+			}
+		}
+	}
+	return nil
+}
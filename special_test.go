@@ -0,0 +1,105 @@
+package splurts
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ProbeMeas struct {
+	Temperature float64 `splurts:"min=-40,max=85,step=0.5,special=DISCONNECTED,WARMUP,CALIBRATING,unit=C"`
+	Pressure    float32 `splurts:"min=900,max=1100,bits=10,special=SATURATED"`
+	Level       float64 `splurts:"min=0,max=100,step=1"`
+}
+
+func TestSpecialValue(t *testing.T) {
+	for _, index := range []int{0, 1, 1234, MAXSPECIALCODES} {
+		f := SpecialValue(index)
+		assert.True(t, math.IsNaN(f))
+		back, isSpecial := SpecialIndex(f)
+		assert.True(t, isSpecial)
+		assert.Equal(t, index, back)
+		back, isSpecial = SpecialIndex(float64(float32(f)))
+		assert.True(t, isSpecial, "must survive float32")
+		assert.Equal(t, index, back)
+	}
+	for _, f := range []float64{math.NaN(), 0, math.Inf(1), -1} {
+		_, isSpecial := SpecialIndex(f)
+		assert.False(t, isSpecial)
+	}
+}
+
+func TestSpecialCodes(t *testing.T) {
+	dut := PiecewiseCoding{Name: "a", Min: 0, Steps: []PiecewiseCodingStep{{Size: 1, Count: 10}}, Specials: []string{"DISCONNECTED", "WARMUP"}}
+	assert.Equal(t, nil, dut.IsInvalid())
+	assert.Equal(t, 4, dut.NumberOfBits())
+	assert.Equal(t, uint64(13), dut.ScaleToUint(SpecialValue(0)))
+	assert.Equal(t, uint64(12), dut.ScaleToUint(SpecialValue(1)))
+	assert.Equal(t, dut.MaxCode(), dut.ScaleToUint(SpecialValue(2)), "unknown special is NaN")
+	assert.Equal(t, uint64(11), dut.ScaleToUint(10), "highest value must not hit special code")
+	assert.Equal(t, float64(10), dut.ScaleToFloat(11))
+
+	warmup, errSpecial := dut.Special("WARMUP")
+	assert.Equal(t, nil, errSpecial)
+	assert.Equal(t, "WARMUP", dut.SpecialName(dut.ScaleToFloat(dut.ScaleToUint(warmup))))
+	s, _ := dut.ToStringValue(warmup)
+	assert.Equal(t, "WARMUP", s)
+	assert.True(t, math.IsInf(dut.ScaleToFloat(dut.MaxCode()-1), 1))
+	assert.True(t, math.IsNaN(dut.ScaleToFloat(dut.MaxCode())))
+	assert.Equal(t, "", dut.SpecialName(dut.ScaleToFloat(dut.MaxCode())))
+	_, errSpecial = dut.Special("SLEEP")
+	assert.NotEqual(t, nil, errSpecial)
+
+	dut.Clamped = true
+	assert.NotEqual(t, nil, dut.IsInvalid())
+	dut.Clamped = false
+	dut.Specials = []string{"A", "A"}
+	assert.NotEqual(t, nil, dut.IsInvalid())
+}
+
+func TestSpecialDirective(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(ProbeMeas{})
+	assert.Equal(t, nil, errRecipe)
+	assert.Equal(t, []string{"DISCONNECTED", "WARMUP", "CALIBRATING"}, recipe[0].Specials)
+	assert.Equal(t, "C", recipe[0].Meta.Unit)
+	assert.Equal(t, 10, recipe[1].NumberOfBits())
+	assert.Equal(t, []string(nil), recipe[2].Specials)
+
+	warmup, _ := recipe[0].Special("WARMUP")
+	saturated, _ := recipe[1].Special("SATURATED")
+	d := ProbeMeas{Temperature: warmup, Pressure: float32(saturated), Level: 42}
+	byt, errSplurt := recipe.Splurts(d)
+	assert.Equal(t, nil, errSplurt)
+	back := ProbeMeas{}
+	assert.Equal(t, nil, recipe.UnSplurts(byt, &back))
+	assert.Equal(t, "WARMUP", recipe[0].SpecialName(back.Temperature))
+	assert.Equal(t, "SATURATED", recipe[1].SpecialName(float64(back.Pressure)))
+	assert.Equal(t, float64(42), back.Level)
+
+	values, errDecode := recipe.Decode(byt, true)
+	assert.Equal(t, nil, errDecode)
+	assert.Equal(t, "WARMUP", recipe[0].SpecialName(values["Temperature"]))
+
+	specials, errSpecials := recipe.DecodeSpecials(byt)
+	assert.Equal(t, nil, errSpecials)
+	assert.Equal(t, map[string]string{"Temperature": "WARMUP", "Pressure": "SATURATED"}, specials, "read from codes, not from NaN payload")
+	_, errSpecials = recipe.DecodeSpecials(byt[1:])
+	assert.NotEqual(t, nil, errSpecials)
+	codec, _ := NewStructCodec(ProbeMeas{})
+	specials, _ = codec.DecodeSpecials(byt)
+	assert.Equal(t, "WARMUP", specials["Temperature"])
+	assert.Equal(t, "DISCONNECTED", recipe[0].SpecialNameOfCode(recipe[0].ScaleToUint(SpecialValue(0))))
+	assert.Equal(t, "", recipe[0].SpecialNameOfCode(recipe[0].MaxCode()), "NaN")
+
+	csv, errCsv := recipe.ToCsv(back, ";", nil, true)
+	assert.Equal(t, nil, errCsv)
+	assert.Equal(t, "WARMUP;SATURATED;42", csv)
+
+	for _, tag := range []string{"min=0,max=1,clamped,special=A", "min=0,max=1,special=A,A", "min=0,max=1,special="} {
+		_, errCoding := createPiecewiseCodingFromStruct("A", "float64", tag)
+		assert.NotEqual(t, nil, errCoding, tag)
+	}
+	_, errCoding := createPiecewiseCodingFromStruct("A", "int", "min=0,max=1,special=A")
+	assert.NotEqual(t, nil, errCoding)
+}
@@ -0,0 +1,151 @@
+/*
+Fixed length text on reduced alphabet. Short identifiers like callsigns, station codes and firmware tags are packed
+to one code, first character on highest bits. Shorter text is padded with first character of alphabet
+*/
+
+package splurts
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	MAXTEXTBITS = 53 //Packed text is passed as float64
+
+	ALPHABET_SIXBIT = "sixbit" //6 bits per character, DEC SIXBIT. Space, uppercase, digits and punctuation. Default
+	ALPHABET_BAUDOT = "baudot" //5 bits per character, like Baudot letters. Space, uppercase and -./?:
+	ALPHABET_ASCII  = "ascii"  //7 bits per character, 7-bit ASCII padded with NUL
+)
+
+var textAlphabets = map[string]string{
+	ALPHABET_SIXBIT: asciiRange(' ', '_'),
+	ALPHABET_BAUDOT: " ABCDEFGHIJKLMNOPQRSTUVWXYZ-./?:",
+	ALPHABET_ASCII:  asciiRange(0, 127),
+}
+
+func asciiRange(first byte, last byte) string {
+	var sb strings.Builder
+	for c := int(first); c <= int(last); c++ {
+		sb.WriteByte(byte(c))
+	}
+	return sb.String()
+}
+
+// textAlphabet characters of alphabet by name. Code of character is index
+func textAlphabet(name string) (string, error) {
+	chars, haz := textAlphabets[name]
+	if !haz {
+		return "", fmt.Errorf("unknown alphabet %v, valid are %v, %v and %v", name, ALPHABET_SIXBIT, ALPHABET_BAUDOT, ALPHABET_ASCII)
+	}
+	return chars, nil
+}
+
+// CharBits bits per character of text
+func (p *PiecewiseCoding) CharBits() int {
+	chars, errAlphabet := textAlphabet(p.Alphabet)
+	if errAlphabet != nil {
+		return 0
+	}
+	return bitsForCodes(uint64(len(chars)))
+}
+
+// textBits bits of whole text
+func (p *PiecewiseCoding) textBits() int {
+	return p.CharBits() * p.TextLength
+}
+
+// TextCode packs text to code. Text longer than TextLength or characters outside of alphabet are errors
+func (p *PiecewiseCoding) TextCode(s string) (uint64, error) {
+	chars, errAlphabet := textAlphabet(p.Alphabet)
+	if errAlphabet != nil {
+		return 0, errAlphabet
+	}
+	if p.TextLength < len(s) {
+		return 0, fmt.Errorf("%v text %#v is longer than %v", p.Name, s, p.TextLength)
+	}
+	charBits := uint(p.CharBits())
+	result := uint64(0)
+	for i := 0; i < p.TextLength; i++ {
+		index := 0 //Padding
+		if i < len(s) {
+			index = strings.IndexByte(chars, s[i])
+			if index < 0 {
+				return 0, fmt.Errorf("%v text %#v have character %q that is not in alphabet %v", p.Name, s, s[i], p.Alphabet)
+			}
+		}
+		result = result<<charBits | uint64(index)
+	}
+	return result, nil
+}
+
+// TextString unpacks text from code. Padding at end is removed
+func (p *PiecewiseCoding) TextString(code uint64) (string, error) {
+	chars, errAlphabet := textAlphabet(p.Alphabet)
+	if errAlphabet != nil {
+		return "", errAlphabet
+	}
+	bits := p.textBits()
+	if code>>uint(bits) != 0 {
+		return "", fmt.Errorf("%v text code %v have more than %v bits", p.Name, code, bits)
+	}
+	charBits := uint(p.CharBits())
+	mask := uint64(1)<<charBits - 1
+	result := make([]byte, p.TextLength)
+	for i := range result {
+		index := code >> (uint(p.TextLength-1-i) * charBits) & mask
+		if uint64(len(chars)) <= index {
+			return "", fmt.Errorf("%v text code %v have character %v outside of alphabet %v", p.Name, code, index, p.Alphabet)
+		}
+		result[i] = chars[index]
+	}
+	return strings.TrimRight(string(result), chars[:1]), nil
+}
+
+func (p *PiecewiseCoding) textToString(f float64) (string, error) {
+	if f < 0 {
+		return "", fmt.Errorf("%s text code is negative %v", p.Name, f)
+	}
+	return p.TextString(uint64(f))
+}
+
+func (p *PiecewiseCoding) textIsInvalid() error {
+	if !p.Clamped {
+		return fmt.Errorf("internal error text must be clamped not automatic +inf -inf")
+	}
+	_, errAlphabet := textAlphabet(p.Alphabet)
+	if errAlphabet != nil {
+		return fmt.Errorf("%v %v", p.Name, errAlphabet.Error())
+	}
+	if p.TextLength <= 0 {
+		return fmt.Errorf("%v text length must be positive, got %v", p.Name, p.TextLength)
+	}
+	if MAXTEXTBITS < p.textBits() {
+		return fmt.Errorf("%v text of %v characters takes %v bits, max is %v bits (%v characters on %v)", p.Name, p.TextLength, p.textBits(), MAXTEXTBITS, MAXTEXTBITS/p.CharBits(), p.Alphabet)
+	}
+	return nil
+}
+
+// textCoding codes string field as packed text. Alphabet is sixbit if not given
+func textCoding(result PiecewiseCoding, typename string) (PiecewiseCoding, error) {
+	if typename != "string" {
+		return result, fmt.Errorf("%v text requires string field, not %v", result.Name, typename)
+	}
+	if result.TextLength == 0 {
+		return result, fmt.Errorf("%v %v directive requires %v directive", result.Name, DIRECTIVEALPHABET, DIRECTIVETEXT)
+	}
+	if 0 < len(result.Enums) {
+		return result, fmt.Errorf("%v can not be text and enum", result.Name)
+	}
+	if result.Alphabet == "" {
+		result.Alphabet = ALPHABET_SIXBIT
+	}
+	result.Clamped = true
+	result.Min = 0
+	errText := result.textIsInvalid()
+	if errText != nil {
+		return result, errText
+	}
+	result.Steps = []PiecewiseCodingStep{{Size: 1, Count: 1<<uint(result.textBits()) - 1}}
+	return result, nil
+}
@@ -0,0 +1,65 @@
+package splurts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type StationMeas struct {
+	Callsign string  `splurts:"text=8"`
+	Station  string  `splurts:"text=10,alphabet=baudot"`
+	Firmware string  `splurts:"alphabet=ascii,text=7"`
+	Temp     float64 `splurts:"step=0.1,min=-40,max=40"`
+}
+
+func TestTextFields(t *testing.T) {
+	recipe, errRecipe := GetPiecewisesFromStruct(StationMeas{})
+	assert.Equal(t, nil, errRecipe)
+	assert.Equal(t, ALPHABET_SIXBIT, recipe[0].Alphabet)
+	assert.Equal(t, 48, recipe[0].NumberOfBits())
+	assert.Equal(t, 50, recipe[1].NumberOfBits())
+	assert.Equal(t, 49, recipe[2].NumberOfBits())
+	assert.Equal(t, 48+50+49+recipe[3].NumberOfBits(), recipe.NumberOfBits())
+
+	d := StationMeas{Callsign: "OH2-ABC", Station: "HELSINKI", Firmware: "v1.2.3b", Temp: 21.5}
+	byt, errSplurt := recipe.Splurts(d)
+	assert.Equal(t, nil, errSplurt)
+	back := StationMeas{}
+	assert.Equal(t, nil, recipe.UnSplurts(byt, &back))
+	assert.Equal(t, d, back)
+
+	values, errDecode := recipe.Decode(byt, true)
+	assert.Equal(t, nil, errDecode)
+	enc, errEncode := recipe.Encode(values)
+	assert.Equal(t, nil, errEncode)
+	assert.Equal(t, byt, enc)
+
+	//First character is on highest bits
+	code, errCode := recipe[1].TextCode("AB")
+	assert.Equal(t, nil, errCode)
+	assert.Equal(t, uint64(1)<<45|uint64(2)<<40, code)
+	s, errText := recipe[1].TextString(code)
+	assert.Equal(t, nil, errText)
+	assert.Equal(t, "AB", s)
+
+	csv, errCsv := recipe.ToCsv([]StationMeas{d, back}, ";", nil, false)
+	assert.Equal(t, nil, errCsv)
+	assert.Equal(t, "OH2-ABC;HELSINKI;v1.2.3b;21.5\nOH2-ABC;HELSINKI;v1.2.3b;21.5\n", csv)
+	strs, _ := recipe.ToStrings(d, true)
+	assert.Equal(t, "\"OH2-ABC\"", strs["Callsign"])
+
+	for _, bad := range []StationMeas{{Callsign: "TOOLONGXX"}, {Callsign: "oh2abc"}, {Station: "OH2"}, {Firmware: "ä"}} {
+		_, errSplurt = recipe.Splurts(bad)
+		assert.NotEqual(t, nil, errSplurt, bad)
+	}
+}
+
+func TestTextDirectives(t *testing.T) {
+	for _, tag := range []string{"text=9", "text=11,alphabet=baudot", "text=0", "text=4,alphabet=ebcdic", "alphabet=ascii", "text=4,enum=A,B"} {
+		_, errCoding := createPiecewiseCodingFromStruct("A", "string", tag)
+		assert.NotEqual(t, nil, errCoding, tag)
+	}
+	_, errCoding := createPiecewiseCodingFromStruct("A", "int", "text=4")
+	assert.NotEqual(t, nil, errCoding)
+}
@@ -0,0 +1,93 @@
+/*
+Generic typed front end. Types are checked by compiler instead of runtime reflect errors
+*/
+
+package splurts
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Codec splurts and unsplurts struct type T. Built on GetPiecewisesFromStruct, safe for concurrent use
+type Codec[T any] struct {
+	sc *StructCodec
+}
+
+// NewCodec creates codec for struct type T with splurts directives
+func NewCodec[T any]() (*Codec[T], error) {
+	var zero T
+	t := reflect.TypeOf(zero)
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("type parameter must be struct, got %v", t)
+	}
+	sc, err := NewStructCodec(zero)
+	if err != nil {
+		return nil, err
+	}
+	return &Codec[T]{sc: sc}, nil
+}
+
+// Piecewises returns copy of PiecewiseFloats describing binary format
+func (c *Codec[T]) Piecewises() PiecewiseFloats {
+	return c.sc.Piecewises()
+}
+
+// RecordSize number of bytes per marshaled record
+func (c *Codec[T]) RecordSize() int {
+	return c.sc.NumberOfBytes()
+}
+
+// Marshal splurts v to new byte array
+func (c *Codec[T]) Marshal(v T) ([]byte, error) {
+	return c.sc.AppendSplurts(make([]byte, 0, c.sc.NumberOfBytes()), &v)
+}
+
+// AppendMarshal appends splurtsed v to dst. Does not allocate when dst have capacity
+func (c *Codec[T]) AppendMarshal(dst []byte, v *T) ([]byte, error) {
+	return c.sc.AppendSplurts(dst, v)
+}
+
+// Unmarshal unsplurts one record
+func (c *Codec[T]) Unmarshal(raw []byte) (T, error) {
+	var result T
+	err := c.sc.UnSplurts(raw, &result)
+	return result, err
+}
+
+// UnmarshalInto unsplurts one record to existing value. Raw is checked before value is modified
+func (c *Codec[T]) UnmarshalInto(raw []byte, v *T) error {
+	return c.sc.UnSplurts(raw, v)
+}
+
+// MarshalSlice splurts records one after another. Each record is padded to full bytes
+func (c *Codec[T]) MarshalSlice(arr []T) ([]byte, error) {
+	result := make([]byte, 0, len(arr)*c.sc.NumberOfBytes())
+	var err error
+	for i := range arr {
+		result, err = c.sc.AppendSplurts(result, &arr[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed on record %v err=%v", i, err.Error())
+		}
+	}
+	return result, nil
+}
+
+// UnmarshalSlice unsplurts records created by MarshalSlice
+func (c *Codec[T]) UnmarshalSlice(raw []byte) ([]T, error) {
+	size := c.sc.NumberOfBytes()
+	if size == 0 {
+		return nil, fmt.Errorf("zero length record")
+	}
+	if len(raw)%size != 0 {
+		return nil, fmt.Errorf("data length %v is not multiple of record size %v", len(raw), size)
+	}
+	result := make([]T, len(raw)/size)
+	for i := range result {
+		err := c.sc.UnSplurts(raw[i*size:(i+1)*size], &result[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed on record %v err=%v", i, err.Error())
+		}
+	}
+	return result, nil
+}
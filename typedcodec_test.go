@@ -0,0 +1,75 @@
+package splurts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypedCodec(t *testing.T) {
+	codec, errCodec := NewCodec[ParticleMeas]()
+	assert.Equal(t, nil, errCodec)
+
+	recipe, _ := GetPiecewisesFromStruct(ParticleMeas{})
+	assert.Equal(t, recipe.NumberOfBytes(), codec.RecordSize())
+	pw := codec.Piecewises()
+	assert.Equal(t, recipe.Names(), pw.Names())
+
+	d := ParticleMeas{SystemStatus: "IDLE", Temperature: 18.3, Humidity: 23.6, Pressure: 102400, Small: 23.2, Large: 41, Heater: true, Emptyvalue: "NO"}
+	byt, errMarshal := codec.Marshal(d)
+	assert.Equal(t, nil, errMarshal)
+	ref, _ := recipe.Splurts(d)
+	assert.Equal(t, ref, byt)
+
+	back, errUnmarshal := codec.Unmarshal(byt)
+	assert.Equal(t, nil, errUnmarshal)
+	wanted := ParticleMeas{}
+	assert.Equal(t, nil, recipe.UnSplurts(ref, &wanted))
+	assert.Equal(t, wanted, back)
+	assert.Equal(t, 42, back.StaticSymbol)
+
+	_, errUnmarshal = codec.Unmarshal(byt[1:])
+	assert.NotEqual(t, nil, errUnmarshal)
+
+	d.SystemStatus = "NOTVALID"
+	_, errMarshal = codec.Marshal(d)
+	assert.NotEqual(t, nil, errMarshal)
+
+	_, errCodec = NewCodec[[]ParticleMeas]()
+	assert.NotEqual(t, nil, errCodec)
+	_, errCodec = NewCodec[*ParticleMeas]()
+	assert.NotEqual(t, nil, errCodec)
+}
+
+func TestTypedCodecSlice(t *testing.T) {
+	codec, errCodec := NewCodec[ParticleMeas]()
+	assert.Equal(t, nil, errCodec)
+	arr := []ParticleMeas{
+		{SystemStatus: "IDLE", Temperature: 22.1, Humidity: 32.4, Pressure: 95200, Small: 69.4, Large: 33, Extra: 2, Emptyvalue: "YES", StaticSymbol: 42},
+		{SystemStatus: "MEASURE", Temperature: 22.2, Humidity: 32.6, Pressure: 95100, Small: 67.1, Large: 34, Extra: 3, Heater: true, Emptyvalue: "YES", StaticSymbol: 42},
+	}
+	byt, errMarshal := codec.MarshalSlice(arr)
+	assert.Equal(t, nil, errMarshal)
+	assert.Equal(t, 2*codec.RecordSize(), len(byt))
+
+	back, errUnmarshal := codec.UnmarshalSlice(byt)
+	assert.Equal(t, nil, errUnmarshal)
+	assert.Equal(t, len(arr), len(back))
+	for i := range arr {
+		again, _ := codec.Marshal(back[i])
+		assert.Equal(t, byt[i*codec.RecordSize():(i+1)*codec.RecordSize()], again)
+		assert.Equal(t, arr[i].SystemStatus, back[i].SystemStatus)
+		assert.InDelta(t, arr[i].Temperature, back[i].Temperature, 0.0001)
+	}
+
+	_, errUnmarshal = codec.UnmarshalSlice(byt[1:])
+	assert.NotEqual(t, nil, errUnmarshal)
+
+	buf := make([]byte, 0, codec.RecordSize())
+	allocs := testing.AllocsPerRun(100, func() {
+		buf, _ = codec.AppendMarshal(buf[:0], &arr[0])
+		codec.UnmarshalInto(buf, &back[1])
+	})
+	assert.Equal(t, float64(0), allocs)
+	assert.Equal(t, back[0], back[1])
+}